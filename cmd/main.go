@@ -2,18 +2,33 @@ package main
 
 import (
 	"context"
+	"image"
 	"log"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 
+	analytics "github.com/joaopaulo-bertoncini/url-shortener/internal/analytics"
+	auth "github.com/joaopaulo-bertoncini/url-shortener/internal/auth"
+	domainlist "github.com/joaopaulo-bertoncini/url-shortener/internal/domainlist"
+	geoip "github.com/joaopaulo-bertoncini/url-shortener/internal/geoip"
 	handler "github.com/joaopaulo-bertoncini/url-shortener/internal/handler"
 	logger "github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
 	metrics "github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
 	middleware "github.com/joaopaulo-bertoncini/url-shortener/internal/middleware"
+	qr "github.com/joaopaulo-bertoncini/url-shortener/internal/qr"
+	ratelimit "github.com/joaopaulo-bertoncini/url-shortener/internal/ratelimit"
 	repo "github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	service "github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+	shortid "github.com/joaopaulo-bertoncini/url-shortener/internal/shortid"
 	telemetry "github.com/joaopaulo-bertoncini/url-shortener/internal/telemetry"
+	urlpolicy "github.com/joaopaulo-bertoncini/url-shortener/internal/urlpolicy"
+	utm "github.com/joaopaulo-bertoncini/url-shortener/internal/utm"
 )
 
 func init() {
@@ -40,26 +55,249 @@ func main() {
 		port = "8080"
 	}
 
-	if err := repo.InitClients(); err != nil {
-		logger.Log.Fatalf("failed to init clients: %v", err)
+	initCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	stores, err := repo.Open(initCtx, repo.ConfigFromEnv())
+	cancel()
+	if err != nil {
+		logger.Log.Fatalf("failed to init stores: %v", err)
+	}
+	defer stores.Close(ctx)
+
+	seq, _ := stores.Links.(repo.Sequencer)
+	idLength, _ := strconv.Atoi(os.Getenv("SHORT_ID_LENGTH"))
+	ids, err := shortid.New(os.Getenv("SHORT_ID_STRATEGY"), idLength, seq)
+	if err != nil {
+		logger.Log.Fatalf("invalid short ID configuration: %v", err)
+	}
+
+	redirectLimit := rateLimitFromEnv("RATE_LIMIT_REDIRECT", "1200/1m")
+	shortenLimit := rateLimitFromEnv("RATE_LIMIT_SHORTEN", "60/1m")
+	batchLimit := rateLimitFromEnv("RATE_LIMIT_BATCH", "10/1m")
+	apiLimit := rateLimitFromEnv("RATE_LIMIT_API", "300/1m")
+	passwordLimit := rateLimitFromEnv("PASSWORD_ATTEMPT_LIMIT", service.DefaultPasswordAttempts.String())
+	var limiter ratelimit.Limiter
+	if stores.Redis != nil {
+		limiter = ratelimit.NewRedisLimiter(stores.Redis)
+	} else {
+		memLimiter := ratelimit.NewMemoryLimiter()
+		go memLimiter.RunSweeper(ctx, maxWindow(redirectLimit, shortenLimit, batchLimit, apiLimit, passwordLimit))
+		limiter = memLimiter
+	}
+
+	domainSources := []domainlist.Source{}
+	if path := os.Getenv("DOMAIN_LIST_FILE"); path != "" {
+		domainSources = append(domainSources, domainlist.FileSource{Path: path})
+	}
+	domainSources = append(domainSources, domainlist.StoreSource{Store: stores.Domains})
+	domains := domainlist.New(domainSources...)
+	if err := domains.Reload(ctx); err != nil {
+		logger.Log.Fatalf("failed to load domain list: %v", err)
+	}
+	reloadInterval, err := time.ParseDuration(os.Getenv("DOMAIN_LIST_RELOAD_INTERVAL"))
+	if err != nil || reloadInterval <= 0 {
+		reloadInterval = 30 * time.Second
+	}
+	go domains.Run(ctx, reloadInterval)
+
+	utmTemplates := utm.NewTemplates(stores.UTM)
+	if err := utmTemplates.Reload(ctx); err != nil {
+		logger.Log.Fatalf("failed to load UTM templates: %v", err)
+	}
+	go utmTemplates.Run(ctx, reloadInterval)
+
+	svcOpts := []service.Option{
+		service.WithIDGenerator(ids),
+		service.WithURLPolicy(urlPolicyFromEnv()),
+		service.WithDomainList(domains),
+		service.WithPasswordAttemptLimit(limiter, passwordLimit),
+		service.WithOwnerUTM(utmTemplates),
+	}
+	if path := os.Getenv("GEOIP_DB_FILE"); path != "" {
+		geo, err := geoip.Open(path)
+		if err != nil {
+			logger.Log.Fatalf("failed to load GeoIP database: %v", err)
+		}
+		geoInterval, err := time.ParseDuration(os.Getenv("GEOIP_RELOAD_INTERVAL"))
+		if err != nil || geoInterval <= 0 {
+			geoInterval = time.Minute
+		}
+		go geo.Run(ctx, geoInterval)
+		svcOpts = append(svcOpts, service.WithGeoIP(geo))
+	}
+	if v := os.Getenv("REDIRECT_STATUS"); v != "" {
+		code, err := strconv.Atoi(v)
+		if err != nil || !service.ValidRedirectType(code) {
+			logger.Log.Fatalf("invalid REDIRECT_STATUS %q: must be 301, 302, 307 or 308", v)
+		}
+		svcOpts = append(svcOpts, service.WithDefaultRedirect(code))
+	}
+	if v := os.Getenv("BATCH_MAX_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			logger.Log.Fatalf("invalid BATCH_MAX_SIZE %q", v)
+		}
+		svcOpts = append(svcOpts, service.WithMaxBatchSize(n))
+	}
+	if v := os.Getenv("BATCH_MAX_PASSWORDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			logger.Log.Fatalf("invalid BATCH_MAX_PASSWORDS %q", v)
+		}
+		svcOpts = append(svcOpts, service.WithMaxBatchPasswords(n))
+	}
+	svc := service.NewShortener(stores.Links, stores.Cache, svcOpts...)
+	sweepInterval, err := time.ParseDuration(os.Getenv("EXPIRY_SWEEP_INTERVAL"))
+	if err != nil || sweepInterval <= 0 {
+		sweepInterval = time.Minute
+	}
+	go svc.RunExpirySweeper(ctx, sweepInterval)
+
+	ipSalt := os.Getenv("CLICK_IP_SALT")
+	if ipSalt == "" {
+		logger.Log.Warn("CLICK_IP_SALT not set, using a random salt: visitor hashes will change on restart")
+	}
+	clickBuffer, _ := strconv.Atoi(os.Getenv("CLICK_BUFFER_SIZE"))
+	recorder := analytics.NewRecorder(stores.Clicks, ipSalt, clickBuffer, 0, 0)
+	recorder.Start()
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		recorder.Close(flushCtx)
+	}()
+
+	urlHandler := handler.NewURLHandler(svc, handler.WithClickRecorder(recorder))
+	analyticsHandler := handler.NewAnalyticsHandler(svc, analytics.NewReporter(stores.Clicks))
+
+	keys := auth.NewKeyManager(stores.Keys, os.Getenv("AUTH_TOKEN"))
+	keyHandler := handler.NewKeyHandler(keys)
+	domainHandler := handler.NewDomainHandler(stores.Domains, domains)
+	utmHandler := handler.NewUTMHandler(stores.UTM, utmTemplates)
+
+	var qrLogo image.Image
+	if path := os.Getenv("QR_LOGO_FILE"); path != "" {
+		if qrLogo, err = qr.LoadLogo(path); err != nil {
+			logger.Log.Fatalf("failed to load QR logo: %v", err)
+		}
+	}
+	qrCacheSize := 256
+	if v := os.Getenv("QR_CACHE_SIZE"); v != "" {
+		if qrCacheSize, err = strconv.Atoi(v); err != nil || qrCacheSize < 0 {
+			logger.Log.Fatalf("invalid QR_CACHE_SIZE %q", v)
+		}
 	}
+	qrHandler := handler.NewQRHandler(svc, qr.NewGenerator(qrLogo, qrCacheSize))
 
 	r := gin.Default()
+	if err := r.SetTrustedProxies(trustedProxiesFromEnv()); err != nil {
+		logger.Log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
 	r.Use(middleware.MetricsMiddleware())
 
 	metrics.InitCustomMetrics()
 
-	r.GET("/:shortID", handler.HandleRedirect)
-	r.GET("/stats/:shortID", handler.HandleStats)
+	r.GET("/:shortID", middleware.RateLimitMiddleware(limiter, "redirect", redirectLimit), urlHandler.HandleRedirect)
+	r.POST("/:shortID", middleware.RateLimitMiddleware(limiter, "unlock", redirectLimit), urlHandler.HandleUnlock)
+	r.GET("/preview/:shortID", middleware.OptionalAuthMiddleware(keys), middleware.RateLimitMiddleware(limiter, "preview", redirectLimit), urlHandler.HandlePreview)
+	r.GET("/qr/:shortID", middleware.RateLimitMiddleware(limiter, "qr", apiLimit), qrHandler.HandleQR)
+	stats := r.Group("/stats", middleware.OptionalAuthMiddleware(keys), middleware.RateLimitMiddleware(limiter, "stats", apiLimit))
+	stats.GET("/:shortID", urlHandler.HandleStats)
+	stats.GET("/:shortID/clicks", analyticsHandler.HandleClicks)
 	r.GET("/metrics", handler.HandleMetrics)
 
 	protected := r.Group("/")
-	protected.Use(middleware.AuthMiddleware())
-	protected.POST("/shorten", handler.HandleShorten)
-	protected.DELETE("/short/:shortID", handler.HandleDelete)
+	protected.Use(middleware.AuthMiddleware(keys))
+	protected.POST("/shorten", middleware.RateLimitMiddleware(limiter, "shorten", shortenLimit), middleware.RequireScope(auth.ScopeLinksWrite), urlHandler.HandleShorten)
+	protected.POST("/shorten/batch", middleware.RateLimitMiddleware(limiter, "shorten_batch", batchLimit), middleware.RequireScope(auth.ScopeLinksWrite), urlHandler.HandleShortenBatch)
+	manage := protected.Group("/", middleware.RateLimitMiddleware(limiter, "api", apiLimit))
+	manage.PATCH("/short/:shortID", middleware.RequireScope(auth.ScopeLinksWrite), urlHandler.HandleUpdate)
+	manage.DELETE("/short/:shortID", middleware.RequireScope(auth.ScopeLinksDelete), urlHandler.HandleDelete)
+	manage.GET("/links", middleware.RequireScope(auth.ScopeStatsRead), urlHandler.HandleList)
+	manage.GET("/utm", middleware.RequireScope(auth.ScopeLinksWrite), utmHandler.HandleGet)
+	manage.PUT("/utm", middleware.RequireScope(auth.ScopeLinksWrite), utmHandler.HandlePut)
+	manage.DELETE("/utm", middleware.RequireScope(auth.ScopeLinksWrite), utmHandler.HandleDelete)
+
+	admin := r.Group("/admin")
+	admin.Use(middleware.AuthMiddleware(keys), middleware.RequireAdmin())
+	admin.POST("/keys", keyHandler.HandleCreate)
+	admin.GET("/keys", keyHandler.HandleList)
+	admin.POST("/keys/:keyID/rotate", keyHandler.HandleRotate)
+	admin.DELETE("/keys/:keyID", keyHandler.HandleRevoke)
+	admin.GET("/domains", domainHandler.HandleList)
+	admin.PUT("/domains/:domain", domainHandler.HandlePut)
+	admin.DELETE("/domains/:domain", domainHandler.HandleDelete)
 
 	logger.Log.Infof("🚀 Starting server on port %s...", port)
 	if err := r.Run(":" + port); err != nil {
 		logger.Log.Fatalf("could not run server: %v", err)
 	}
 }
+
+// rateLimitFromEnv reads a rate limit such as "100/1m" from the environment
+// variable name, falling back to def when it is unset.
+func rateLimitFromEnv(name, def string) ratelimit.Limit {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		v = def
+	}
+	limit, err := ratelimit.ParseLimit(v)
+	if err != nil {
+		logger.Log.Fatalf("invalid %s %q: %v", name, v, err)
+	}
+	return limit
+}
+
+// trustedProxiesFromEnv reads TRUSTED_PROXIES, a comma-separated list of the
+// addresses or CIDR ranges of the reverse proxies in front of the service.
+// Forwarding headers such as X-Forwarded-For are only believed when sent by
+// one of them; unset, the client IP is always the peer address.
+func trustedProxiesFromEnv() []string {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
+func maxWindow(limits ...ratelimit.Limit) time.Duration {
+	longest := time.Minute
+	for _, l := range limits {
+		if l.Window > longest {
+			longest = l.Window
+		}
+	}
+	return longest
+}
+
+// urlPolicyFromEnv builds the destination policy from URL_ALLOWED_SCHEMES,
+// URL_ALLOW_PRIVATE, URL_ALLOW_HOMOGRAPHS and URL_RESOLVE_HOSTS.
+func urlPolicyFromEnv() *urlpolicy.Policy {
+	policy := urlpolicy.Default()
+	if v := os.Getenv("URL_ALLOWED_SCHEMES"); v != "" {
+		policy.Schemes = nil
+		for _, scheme := range strings.Split(v, ",") {
+			if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+				policy.Schemes = append(policy.Schemes, scheme)
+			}
+		}
+	}
+	policy.AllowPrivate = envBool("URL_ALLOW_PRIVATE")
+	policy.AllowHomographs = envBool("URL_ALLOW_HOMOGRAPHS")
+	if envBool("URL_RESOLVE_HOSTS") {
+		policy.Resolver = net.DefaultResolver
+	}
+	return policy
+}
+
+func envBool(name string) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		logger.Log.Fatalf("invalid %s %q: must be true or false", name, v)
+	}
+	return b
+}
@@ -0,0 +1,79 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	chromeMac     = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	safariIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"
+	firefoxLinux  = "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0"
+	chromeAndroid = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	cases := map[string]Agent{
+		chromeMac:     {Browser: "Chrome", OS: "macOS", Device: DeviceDesktop},
+		safariIPhone:  {Browser: "Safari", OS: "iOS", Device: DeviceMobile},
+		firefoxLinux:  {Browser: "Firefox", OS: "Linux", Device: DeviceDesktop},
+		chromeAndroid: {Browser: "Chrome", OS: "Android", Device: DeviceMobile},
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)": {Browser: "Bot", OS: "Other", Device: DeviceBot},
+		"": {Browser: "Unknown", OS: "Unknown", Device: DeviceUnknown},
+	}
+	for ua, want := range cases {
+		assert.Equal(t, want, ParseUserAgent(ua), ua)
+	}
+}
+
+func TestReporter_BucketsAndBreakdowns(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryClickStore()
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, store.InsertClicks(ctx, []ClickEvent{
+		{ShortID: "abc12345", Timestamp: base.Add(5 * time.Minute), Referrer: "https://www.google.com/search?q=x", UserAgent: chromeMac},
+		{ShortID: "abc12345", Timestamp: base.Add(50 * time.Minute), UserAgent: safariIPhone, Country: "BR"},
+		{ShortID: "abc12345", Timestamp: base.Add(150 * time.Minute), Referrer: "https://google.com/", UserAgent: firefoxLinux},
+	}))
+
+	rep, err := NewReporter(store).Report(ctx, "abc12345", IntervalHour, base.Add(10*time.Minute), base.Add(2*time.Hour+30*time.Minute))
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, rep.TotalClicks)
+	require.Len(t, rep.Buckets, 3)
+	assert.Equal(t, []int{2, 0, 1}, []int{rep.Buckets[0].Clicks, rep.Buckets[1].Clicks, rep.Buckets[2].Clicks})
+	assert.Equal(t, map[string]int{"google.com": 2, "direct": 1}, rep.Referrers)
+	assert.Equal(t, map[string]int{DeviceDesktop: 2, DeviceMobile: 1}, rep.Devices)
+	assert.Equal(t, 1, rep.Browsers["Safari"])
+	assert.Equal(t, 1, rep.OS["iOS"])
+	assert.Equal(t, map[string]int{"BR": 1, "unknown": 2}, rep.Countries)
+
+	_, err = NewReporter(store).Report(ctx, "abc12345", IntervalHour, base, base.AddDate(1, 0, 0))
+	assert.ErrorIs(t, err, ErrInvalidRange)
+}
+
+func TestRecorder_FlushesOnClose(t *testing.T) {
+	require.NoError(t, logger.InitLogger())
+	store := repository.NewMemoryClickStore()
+	rec := NewRecorder(store, "salt", 10, 100, time.Hour)
+	rec.Start()
+
+	now := time.Now().UTC()
+	for i := 0; i < 3; i++ {
+		rec.Record(ClickEvent{ShortID: "abc12345", Timestamp: now, IPHash: rec.HashIP("203.0.113.7")})
+	}
+	rec.Close(context.Background())
+
+	got, err := store.ListClicks(context.Background(), "abc12345", now, now.Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	assert.Len(t, got[0].IPHash, 32)
+	assert.NotContains(t, got[0].IPHash, "203.0.113.7")
+	assert.Equal(t, rec.HashIP("203.0.113.7"), got[0].IPHash)
+}
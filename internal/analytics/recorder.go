@@ -0,0 +1,149 @@
+// Package analytics records redirect click events and aggregates them into
+// time-bucketed reports.
+package analytics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+)
+
+type ClickEvent = repository.ClickEvent
+
+const (
+	DefaultBufferSize    = 10000
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = 2 * time.Second
+)
+
+// Recorder buffers click events in memory and writes them to a ClickStore in
+// batches from a background goroutine, so redirects never wait on analytics.
+// When the buffer is full new events are dropped and counted.
+type Recorder struct {
+	store         repository.ClickStore
+	salt          []byte
+	events        chan ClickEvent
+	batchSize     int
+	flushInterval time.Duration
+
+	quit chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewRecorder creates a Recorder; call Start to begin flushing. ipSalt keys the
+// visitor IP hash. When empty a random per-process salt is used, so hashes are
+// only comparable within one process lifetime.
+func NewRecorder(store repository.ClickStore, ipSalt string, bufferSize, batchSize int, flushInterval time.Duration) *Recorder {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = DefaultFlushInterval
+	}
+	salt := []byte(ipSalt)
+	if len(salt) == 0 {
+		salt = make([]byte, 32)
+		_, _ = rand.Read(salt)
+	}
+	return &Recorder{
+		store:         store,
+		salt:          salt,
+		events:        make(chan ClickEvent, bufferSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		quit:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// HashIP returns a keyed, irreversible digest of ip.
+func (r *Recorder) HashIP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, r.salt)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Record enqueues ev without blocking.
+func (r *Recorder) Record(ev ClickEvent) {
+	select {
+	case r.events <- ev:
+	default:
+		metrics.ClickEvents.WithLabelValues("dropped").Inc()
+	}
+}
+
+func (r *Recorder) Start() {
+	go r.run()
+}
+
+// Close stops the background goroutine after flushing buffered events, or
+// when ctx is done, whichever comes first.
+func (r *Recorder) Close(ctx context.Context) {
+	r.once.Do(func() { close(r.quit) })
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+	}
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]ClickEvent, 0, r.batchSize)
+	for {
+		select {
+		case ev := <-r.events:
+			batch = append(batch, ev)
+			if len(batch) >= r.batchSize {
+				batch = r.flush(batch)
+			}
+		case <-ticker.C:
+			batch = r.flush(batch)
+		case <-r.quit:
+			for {
+				select {
+				case ev := <-r.events:
+					batch = append(batch, ev)
+					if len(batch) >= r.batchSize {
+						batch = r.flush(batch)
+					}
+				default:
+					r.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Recorder) flush(batch []ClickEvent) []ClickEvent {
+	if len(batch) == 0 {
+		return batch
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := r.store.InsertClicks(ctx, batch); err != nil {
+		metrics.ClickEvents.WithLabelValues("failed").Add(float64(len(batch)))
+		logger.Log.Errorf("Click events insert error: %v", err)
+	} else {
+		metrics.ClickEvents.WithLabelValues("stored").Add(float64(len(batch)))
+	}
+	return batch[:0]
+}
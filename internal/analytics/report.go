@@ -0,0 +1,146 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+)
+
+type Interval string
+
+const (
+	IntervalHour Interval = "hour"
+	IntervalDay  Interval = "day"
+
+	// maxBuckets bounds the size of a single report.
+	maxBuckets = 2000
+)
+
+var (
+	ErrInvalidInterval = errors.New("interval must be hour or day")
+	ErrInvalidRange    = errors.New("invalid time range")
+)
+
+func (i Interval) duration() time.Duration {
+	if i == IntervalDay {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
+
+// ParseInterval accepts "hour", "day" or empty (hour).
+func ParseInterval(s string) (Interval, error) {
+	switch Interval(s) {
+	case "", IntervalHour:
+		return IntervalHour, nil
+	case IntervalDay:
+		return IntervalDay, nil
+	default:
+		return "", ErrInvalidInterval
+	}
+}
+
+// Bucket counts the clicks in [Start, Start+interval).
+type Bucket struct {
+	Start  time.Time `json:"start"`
+	Clicks int       `json:"clicks"`
+}
+
+// Report is the aggregated view of a link's clicks over a time range.
+type Report struct {
+	ShortID     string         `json:"short_id"`
+	Interval    Interval       `json:"interval"`
+	From        time.Time      `json:"from"`
+	To          time.Time      `json:"to"`
+	TotalClicks int            `json:"total_clicks"`
+	Buckets     []Bucket       `json:"buckets"`
+	Referrers   map[string]int `json:"referrers"`
+	Browsers    map[string]int `json:"browsers"`
+	OS          map[string]int `json:"os"`
+	Devices     map[string]int `json:"devices"`
+	Countries   map[string]int `json:"countries"`
+}
+
+// Reporter builds Reports from a ClickStore.
+type Reporter struct {
+	store repository.ClickStore
+}
+
+func NewReporter(store repository.ClickStore) *Reporter {
+	return &Reporter{store: store}
+}
+
+// Report aggregates the clicks of shortID between from and to. Both bounds
+// are truncated to the interval (in UTC) and every bucket in the range is
+// present, including empty ones.
+func (r *Reporter) Report(ctx context.Context, shortID string, interval Interval, from, to time.Time) (*Report, error) {
+	step := interval.duration()
+	from = from.UTC().Truncate(step)
+	to = to.UTC().Truncate(step).Add(step)
+	if !from.Before(to) || to.Sub(from)/step > maxBuckets {
+		return nil, ErrInvalidRange
+	}
+
+	events, err := r.store.ListClicks(ctx, shortID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return Aggregate(shortID, events, interval, from, to), nil
+}
+
+// Aggregate groups events into interval-sized buckets covering [from, to).
+// from must already be aligned to the interval.
+func Aggregate(shortID string, events []ClickEvent, interval Interval, from, to time.Time) *Report {
+	step := interval.duration()
+	rep := &Report{
+		ShortID:   shortID,
+		Interval:  interval,
+		From:      from,
+		To:        to,
+		Buckets:   []Bucket{},
+		Referrers: map[string]int{},
+		Browsers:  map[string]int{},
+		OS:        map[string]int{},
+		Devices:   map[string]int{},
+		Countries: map[string]int{},
+	}
+	for t := from; t.Before(to); t = t.Add(step) {
+		rep.Buckets = append(rep.Buckets, Bucket{Start: t})
+	}
+
+	for _, ev := range events {
+		if ev.Timestamp.Before(from) || !ev.Timestamp.Before(to) {
+			continue
+		}
+		rep.TotalClicks++
+		rep.Buckets[int(ev.Timestamp.Sub(from)/step)].Clicks++
+		rep.Referrers[ReferrerDomain(ev.Referrer)]++
+		agent := ParseUserAgent(ev.UserAgent)
+		rep.Browsers[agent.Browser]++
+		rep.OS[agent.OS]++
+		rep.Devices[agent.Device]++
+		country := ev.Country
+		if country == "" {
+			country = "unknown"
+		}
+		rep.Countries[country]++
+	}
+	return rep
+}
+
+// ReferrerDomain reduces a Referer header to its host, without a leading
+// "www.". Visits without a referrer are reported as "direct".
+func ReferrerDomain(referrer string) string {
+	if referrer == "" {
+		return "direct"
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Hostname() == "" {
+		return "unknown"
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
@@ -0,0 +1,260 @@
+// Package auth issues and verifies the API keys used by the management API.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+)
+
+type APIKey = repository.APIKey
+
+const (
+	ScopeLinksWrite  = "links:write"
+	ScopeLinksDelete = "links:delete"
+	ScopeStatsRead   = "stats:read"
+
+	// BootstrapKeyID identifies the principal authenticated by AUTH_TOKEN.
+	BootstrapKeyID = "bootstrap"
+	// AdminOwner owns the bootstrap principal.
+	AdminOwner = "admin"
+
+	tokenPrefix = "sk_"
+
+	// touchInterval limits how often last_used_at is written for a busy key.
+	touchInterval = time.Minute
+)
+
+// Scopes lists every scope a key can be granted.
+var Scopes = []string{ScopeLinksWrite, ScopeLinksDelete, ScopeStatsRead}
+
+var (
+	ErrInvalidKey   = errors.New("invalid API key")
+	ErrInvalidScope = errors.New("unknown scope")
+	ErrMissingOwner = errors.New("owner is required")
+	ErrKeyNotFound  = errors.New("API key not found")
+	ErrKeyRevoked   = errors.New("API key already revoked")
+)
+
+// Principal is the caller a request was authenticated as.
+type Principal struct {
+	KeyID  string   `json:"key_id"`
+	Owner  string   `json:"owner"`
+	Scopes []string `json:"scopes"`
+	Admin  bool     `json:"admin"`
+}
+
+// Can reports whether p was granted scope. Admins hold every scope.
+func (p *Principal) Can(scope string) bool {
+	return p != nil && (p.Admin || slices.Contains(p.Scopes, scope))
+}
+
+// KeySpec describes a key to create.
+type KeySpec struct {
+	Owner     string
+	Name      string
+	Scopes    []string
+	Admin     bool
+	ExpiresAt *time.Time
+}
+
+// KeyManager creates, rotates and verifies API keys. Keys are random tokens
+// of the form sk_<id>_<secret>; only their SHA-256 is stored.
+type KeyManager struct {
+	store     repository.KeyStore
+	bootstrap []byte
+	now       func() time.Time
+}
+
+// NewKeyManager returns a KeyManager backed by store. A non-empty
+// bootstrapToken is accepted as an admin key, so the first real keys can be
+// created.
+func NewKeyManager(store repository.KeyStore, bootstrapToken string) *KeyManager {
+	m := &KeyManager{store: store, now: time.Now}
+	if bootstrapToken != "" {
+		m.bootstrap = hashToken(bootstrapToken)
+	}
+	return m
+}
+
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// Authenticate resolves a bearer token to its Principal. Every failure is
+// reported as ErrInvalidKey so callers cannot probe which keys exist.
+func (m *KeyManager) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	hash := hashToken(token)
+	if m.bootstrap != nil && subtle.ConstantTimeCompare(hash, m.bootstrap) == 1 {
+		return &Principal{KeyID: BootstrapKeyID, Owner: AdminOwner, Scopes: Scopes, Admin: true}, nil
+	}
+
+	id, ok := parseToken(token)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	key, err := m.store.GetKey(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	stored, err := hex.DecodeString(key.Hash)
+	if err != nil || subtle.ConstantTimeCompare(hash, stored) != 1 {
+		return nil, ErrInvalidKey
+	}
+	now := m.now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)) {
+		return nil, ErrInvalidKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= touchInterval {
+		go m.touch(key.ID, now)
+	}
+	return &Principal{KeyID: key.ID, Owner: key.Owner, Scopes: key.Scopes, Admin: key.Admin}, nil
+}
+
+func (m *KeyManager) touch(id string, at time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.store.TouchKey(ctx, id, at); err != nil {
+		logger.Log.Warnf("API key last-used update error: %v", err)
+	}
+}
+
+// parseToken extracts the key ID from sk_<id>_<secret>.
+func parseToken(token string) (string, bool) {
+	rest, ok := strings.CutPrefix(token, tokenPrefix)
+	if !ok {
+		return "", false
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// Create stores a new key and returns it with its plaintext token, which
+// cannot be recovered later.
+func (m *KeyManager) Create(ctx context.Context, spec KeySpec) (string, *APIKey, error) {
+	if spec.Owner == "" {
+		return "", nil, ErrMissingOwner
+	}
+	for _, scope := range spec.Scopes {
+		if !slices.Contains(Scopes, scope) {
+			return "", nil, fmt.Errorf("%w %q", ErrInvalidScope, scope)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		id, err := randomString(8)
+		if err != nil {
+			return "", nil, err
+		}
+		token, hash, err := newSecret(id)
+		if err != nil {
+			return "", nil, err
+		}
+		key := &APIKey{
+			ID:        id,
+			Owner:     spec.Owner,
+			Name:      spec.Name,
+			Hash:      hash,
+			Scopes:    slices.Clone(spec.Scopes),
+			Admin:     spec.Admin,
+			CreatedAt: m.now().UTC(),
+			ExpiresAt: spec.ExpiresAt,
+		}
+		err = m.store.CreateKey(ctx, key)
+		if errors.Is(err, repository.ErrDuplicate) && attempt < 3 {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		return token, key, nil
+	}
+}
+
+func (m *KeyManager) List(ctx context.Context, owner string) ([]APIKey, error) {
+	return m.store.ListKeys(ctx, owner)
+}
+
+// Rotate replaces the secret of a key, keeping its ID, owner and scopes. The
+// previous token stops working immediately.
+func (m *KeyManager) Rotate(ctx context.Context, id string) (string, *APIKey, error) {
+	key, err := m.get(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	if key.RevokedAt != nil {
+		return "", nil, ErrKeyRevoked
+	}
+	token, hash, err := newSecret(key.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	key.Hash = hash
+	if err := m.store.UpdateKey(ctx, key); err != nil {
+		return "", nil, err
+	}
+	return token, key, nil
+}
+
+// Revoke disables a key permanently.
+func (m *KeyManager) Revoke(ctx context.Context, id string) (*APIKey, error) {
+	key, err := m.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return key, nil
+	}
+	now := m.now().UTC()
+	key.RevokedAt = &now
+	if err := m.store.UpdateKey(ctx, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (m *KeyManager) get(ctx context.Context, id string) (*APIKey, error) {
+	key, err := m.store.GetKey(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrKeyNotFound
+	}
+	return key, err
+}
+
+func newSecret(id string) (token, hash string, err error) {
+	secret, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	token = tokenPrefix + id + "_" + secret
+	return token, hex.EncodeToString(hashToken(token)), nil
+}
+
+// randomString returns n random bytes, base64url-encoded without padding or
+// underscores so the token stays splittable on "_".
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(base64.RawURLEncoding.EncodeToString(b), "_", "-"), nil
+}
@@ -0,0 +1,185 @@
+// Package domainlist matches destination hosts against block and allow rules
+// loaded from a file and from the database, reloaded while the service runs.
+package domainlist
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/idna"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+)
+
+type Rule = repository.DomainRule
+
+var ErrInvalidDomain = errors.New("invalid domain")
+
+// NormalizeDomain lower-cases domain, drops a leading "*." and a trailing dot,
+// and converts it to punycode.
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(domain), "*."), ".")
+	if domain == "" || strings.ContainsAny(domain, "/:@ ") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDomain, domain)
+	}
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDomain, domain)
+	}
+	return ascii, nil
+}
+
+// Source provides a set of rules.
+type Source interface {
+	Load(ctx context.Context) ([]Rule, error)
+}
+
+// StoreSource loads the rules managed through the admin API.
+type StoreSource struct {
+	Store repository.DomainStore
+}
+
+func (s StoreSource) Load(ctx context.Context) ([]Rule, error) {
+	return s.Store.ListDomainRules(ctx)
+}
+
+// FileSource loads rules from a text file with one domain per line, blocked
+// unless prefixed with "!", optionally followed by a reason:
+//
+//	# comment
+//	phish.example        credential phishing
+//	!docs.phish.example
+type FileSource struct {
+	Path string
+}
+
+func (s FileSource) Load(ctx context.Context) ([]Rule, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []Rule
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		domain, reason := fields[0], strings.Join(fields[1:], " ")
+		action := repository.DomainBlock
+		if strings.HasPrefix(domain, "!") {
+			domain, action = domain[1:], repository.DomainAllow
+		}
+		domain, err := NormalizeDomain(domain)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", s.Path, n, err)
+		}
+		rules = append(rules, Rule{Domain: domain, Action: action, Reason: reason})
+	}
+	return rules, scanner.Err()
+}
+
+// List holds the rules of its sources. Matching reads an immutable snapshot,
+// replaced as a whole by Reload.
+type List struct {
+	sources []Source
+	rules   atomic.Pointer[map[string]Rule]
+	mu      sync.Mutex // serializes Reload
+}
+
+// New returns an empty List; call Reload to load the sources. Rules of later
+// sources replace those of earlier ones for the same domain.
+func New(sources ...Source) *List {
+	l := &List{sources: sources}
+	l.rules.Store(&map[string]Rule{})
+	return l
+}
+
+// Reload loads every source and swaps in the new rules. On error the current
+// rules are kept.
+func (l *List) Reload(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rules := make(map[string]Rule)
+	for _, src := range l.sources {
+		loaded, err := src.Load(ctx)
+		if err != nil {
+			return err
+		}
+		for _, r := range loaded {
+			rules[r.Domain] = r
+		}
+	}
+	l.rules.Store(&rules)
+	return nil
+}
+
+// Run reloads the list every interval until ctx is done.
+func (l *List) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Reload(ctx); err != nil {
+				logger.Log.Warnf("Domain list reload error: %v", err)
+			}
+		}
+	}
+}
+
+// Len returns the number of loaded rules.
+func (l *List) Len() int {
+	return len(*l.rules.Load())
+}
+
+// Match returns the most specific rule for host or one of its parent domains.
+func (l *List) Match(host string) (Rule, bool) {
+	rules := *l.rules.Load()
+	if len(rules) == 0 {
+		return Rule{}, false
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		host = ascii
+	}
+	for {
+		if r, ok := rules[host]; ok {
+			return r, true
+		}
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok {
+			return Rule{}, false
+		}
+		host = parent
+	}
+}
+
+// Blocked reports whether the host of rawURL is blocked, with the rule that
+// blocks it.
+func (l *List) Blocked(rawURL string) (Rule, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Rule{}, false
+	}
+	r, ok := l.Match(u.Hostname())
+	if !ok || r.Action != repository.DomainBlock {
+		return Rule{}, false
+	}
+	return r, true
+}
@@ -0,0 +1,67 @@
+package domainlist
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+)
+
+func TestList_MatchesMostSpecificRule(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	require.NoError(t, os.WriteFile(path, []byte(`
+# phishing
+phish.example   credential phishing
+!docs.phish.example
+*.Bücher.example
+`), 0o600))
+
+	store := repository.NewMemoryDomainStore()
+	list := New(FileSource{Path: path}, StoreSource{Store: store})
+	require.NoError(t, list.Reload(ctx))
+	assert.Equal(t, 3, list.Len())
+
+	r, ok := list.Blocked("https://login.PHISH.example./x")
+	require.True(t, ok)
+	assert.Equal(t, "credential phishing", r.Reason)
+
+	_, ok = list.Blocked("https://docs.phish.example/")
+	assert.False(t, ok)
+	_, ok = list.Blocked("https://api.docs.phish.example/")
+	assert.False(t, ok)
+	_, ok = list.Blocked("https://xn--bcher-kva.example/")
+	assert.True(t, ok)
+	_, ok = list.Blocked("https://notphish.example/")
+	assert.False(t, ok)
+
+	// Database rules override the file and take effect on reload.
+	require.NoError(t, store.PutDomainRule(ctx, &repository.DomainRule{Domain: "phish.example", Action: repository.DomainAllow}))
+	require.NoError(t, store.PutDomainRule(ctx, &repository.DomainRule{Domain: "example.org", Action: repository.DomainBlock}))
+	_, ok = list.Blocked("https://example.org/")
+	assert.False(t, ok)
+	require.NoError(t, list.Reload(ctx))
+	_, ok = list.Blocked("https://login.phish.example/")
+	assert.False(t, ok)
+	_, ok = list.Blocked("https://www.example.org/")
+	assert.True(t, ok)
+}
+
+func TestList_ReloadKeepsRulesOnError(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	require.NoError(t, os.WriteFile(path, []byte("phish.example\n"), 0o600))
+
+	list := New(FileSource{Path: path})
+	require.NoError(t, list.Reload(ctx))
+
+	require.NoError(t, os.WriteFile(path, []byte("phish.example/login\n"), 0o600))
+	assert.ErrorIs(t, list.Reload(ctx), ErrInvalidDomain)
+	_, ok := list.Blocked("https://phish.example/")
+	assert.True(t, ok)
+}
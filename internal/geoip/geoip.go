@@ -0,0 +1,131 @@
+// Package geoip resolves visitor IPs to countries with a local MaxMind-format
+// (.mmdb) database. Lookups never leave the process, and the database can be
+// replaced on disk while the service runs.
+package geoip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
+)
+
+// record is the part of a GeoIP2/GeoLite2 Country or City record we read.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// DB is a country database loaded in memory. Lookups read an immutable
+// reader, replaced as a whole by Reload.
+type DB struct {
+	path   string
+	reader atomic.Pointer[maxminddb.Reader]
+
+	mu      sync.Mutex // serializes Reload
+	modTime time.Time
+	size    int64
+}
+
+// Open loads the database at path.
+func Open(path string) (*DB, error) {
+	db := &DB{path: path}
+	if err := db.Reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Reload reads the database file again and swaps it in. On error the current
+// database is kept.
+func (db *DB) Reload() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.load()
+}
+
+func (db *DB) load() error {
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(db.path)
+	if err != nil {
+		return err
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return fmt.Errorf("open GeoIP database %s: %w", db.path, err)
+	}
+	// The previous reader is not closed: lookups may still be using it, and
+	// readers built from bytes hold nothing but memory.
+	db.reader.Store(reader)
+	db.modTime, db.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// reloadIfChanged reloads the database when its file was replaced since the
+// last load, and reports whether it did.
+func (db *DB) reloadIfChanged() (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(db.modTime) && info.Size() == db.size {
+		return false, nil
+	}
+	return true, db.load()
+}
+
+// Run checks the database file every interval until ctx is done and swaps in
+// new versions of it.
+func (db *DB) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := db.reloadIfChanged()
+			if err != nil {
+				logger.Log.Warnf("GeoIP database reload error: %v", err)
+			} else if reloaded {
+				logger.Log.Infof("GeoIP database %s reloaded", db.path)
+			}
+		}
+	}
+}
+
+// Country returns the upper-case ISO 3166-1 alpha-2 code of the country of
+// ip, falling back to the country the network is registered in, or "" when
+// ip is invalid or not in the database.
+func (db *DB) Country(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	var rec record
+	if err := db.reader.Load().Lookup(parsed, &rec); err != nil {
+		return ""
+	}
+	code := rec.Country.ISOCode
+	if code == "" {
+		code = rec.RegisteredCountry.ISOCode
+	}
+	return strings.ToUpper(code)
+}
@@ -0,0 +1,65 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeDB writes a country database mapping each CIDR to an ISO code.
+func writeDB(t *testing.T, path string, networks map[string]string) {
+	t.Helper()
+	w, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: "GeoLite2-Country", RecordSize: 24})
+	require.NoError(t, err)
+	for cidr, code := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		require.NoError(t, w.Insert(network, mmdbtype.Map{
+			"country": mmdbtype.Map{"iso_code": mmdbtype.String(code)},
+		}))
+	}
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = w.WriteTo(f)
+	require.NoError(t, err)
+}
+
+func TestDB_CountryAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	writeDB(t, path, map[string]string{"81.2.69.0/24": "GB", "2001:218::/32": "jp"})
+
+	db, err := Open(path)
+	require.NoError(t, err)
+	assert.Equal(t, "GB", db.Country("81.2.69.142"))
+	assert.Equal(t, "JP", db.Country("2001:218::1"))
+	assert.Equal(t, "", db.Country("8.8.8.8"))
+	assert.Equal(t, "", db.Country("not-an-ip"))
+
+	reloaded, err := db.reloadIfChanged()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	// A broken file is rejected and the loaded database stays in use.
+	require.NoError(t, os.WriteFile(path, []byte("garbage"), 0o600))
+	assert.Error(t, db.Reload())
+	assert.Equal(t, "GB", db.Country("81.2.69.142"))
+
+	writeDB(t, path, map[string]string{"81.2.69.0/24": "IE"})
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, future, future))
+	reloaded, err = db.reloadIfChanged()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, "IE", db.Country("81.2.69.142"))
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing.mmdb"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/analytics"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/auth"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// defaultClicksWindow is the report range when the caller gives no "from".
+const defaultClicksWindow = 7 * 24 * time.Hour
+
+// AnalyticsHandler serves click reports.
+type AnalyticsHandler struct {
+	svc      *service.Shortener
+	reporter *analytics.Reporter
+}
+
+func NewAnalyticsHandler(svc *service.Shortener, reporter *analytics.Reporter) *AnalyticsHandler {
+	return &AnalyticsHandler{svc: svc, reporter: reporter}
+}
+
+// HandleClicks returns the clicks of a link bucketed by hour or day.
+// Query parameters: interval (hour|day), from and to (RFC 3339).
+func (h *AnalyticsHandler) HandleClicks(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandleClicks")
+	defer span.End()
+
+	shortID := c.Param("shortID")
+	interval, err := analytics.ParseInterval(c.Query("interval"))
+	if err != nil {
+		span.SetStatus(codes.Error, "invalid interval")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to := time.Now()
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			span.SetStatus(codes.Error, "invalid to")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 timestamp"})
+			return
+		}
+	}
+	from := to.Add(-defaultClicksWindow)
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			span.SetStatus(codes.Error, "invalid from")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 timestamp"})
+			return
+		}
+	}
+
+	if _, err := h.svc.GetURLStats(ctx, shortID, callerFor(c, auth.ScopeStatsRead)); err != nil {
+		span.SetStatus(codes.Error, "short ID not available")
+		span.RecordError(err)
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, service.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, service.ErrForbidden):
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.reporter.Report(ctx, shortID, interval, from, to)
+	if errors.Is(err, analytics.ErrInvalidRange) {
+		span.SetStatus(codes.Error, "invalid range")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to build click report")
+		span.RecordError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	span.SetAttributes(attribute.String("short_id", shortID), attribute.Int("total_clicks", report.TotalClicks))
+	c.JSON(http.StatusOK, report)
+}
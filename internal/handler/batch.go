@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/auth"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type batchBody struct {
+	Items []reqBody `json:"items" binding:"required"`
+	// AllOrNothing stores either every item or none of them.
+	AllOrNothing bool `json:"all_or_nothing"`
+}
+
+type batchItemResult struct {
+	Index     int        `json:"index"`
+	ShortID   string     `json:"short_id,omitempty"`
+	ShortURL  string     `json:"short_url,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Reused    bool       `json:"reused,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+var errInvalidURL = errors.New("invalid url")
+
+// HandleShortenBatch serves POST /shorten/batch and reports the outcome of
+// every item in request order.
+func (h *URLHandler) HandleShortenBatch(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandleShortenBatch")
+	defer span.End()
+
+	var body batchBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		span.SetStatus(codes.Error, "invalid request body")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	if len(body.Items) == 0 || len(body.Items) > h.svc.MaxBatchSize() {
+		span.SetStatus(codes.Error, "invalid batch size")
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("items must contain between 1 and %d entries", h.svc.MaxBatchSize())})
+		return
+	}
+
+	owner := callerFor(c, auth.ScopeLinksWrite).Owner
+	results := make([]service.BatchResult, len(body.Items))
+	var items []service.BatchItem
+	var positions []int
+	for i, item := range body.Items {
+		if err := binding.Validator.ValidateStruct(&item); err != nil {
+			results[i].Err = errInvalidURL
+			continue
+		}
+		items = append(items, service.BatchItem{
+			LongURL: item.URL,
+			Options: service.ShortenOptions{
+				Alias:        item.Alias,
+				ExpiresAt:    item.ExpiresAt,
+				TTL:          time.Duration(item.TTLSeconds) * time.Second,
+				MaxClicks:    item.MaxClicks,
+				RedirectType: item.RedirectType,
+				Owner:        owner,
+				PrivateStats: item.PrivateStats,
+				Tags:         item.Tags,
+
+				ReuseExisting: item.ReuseExisting,
+				Password:      item.Password,
+				Interstitial:  item.Interstitial,
+				Rules:         item.Rules,
+				Variants:      item.Variants,
+				UTM:           item.UTM,
+
+				QueryPassthrough: item.QueryPassthrough,
+			},
+		})
+		positions = append(positions, i)
+	}
+
+	switch {
+	case len(items) == 0:
+	case len(items) < len(body.Items) && body.AllOrNothing:
+		for _, i := range positions {
+			results[i].Err = service.ErrBatchAborted
+		}
+	default:
+		created, err := h.svc.ShortenBatch(ctx, items, body.AllOrNothing)
+		if errors.Is(err, service.ErrBatchTooLarge) {
+			span.SetStatus(codes.Error, "invalid batch size")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrAtomicUnsupported) {
+			span.SetStatus(codes.Error, "atomic batches not supported")
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "all_or_nothing is not supported by the configured store"})
+			return
+		}
+		if err != nil {
+			span.SetStatus(codes.Error, "failed to shorten batch")
+			span.RecordError(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for k, r := range created {
+			results[positions[k]] = r
+		}
+	}
+
+	resp := make([]batchItemResult, len(results))
+	succeeded, reused := 0, 0
+	for i, r := range results {
+		resp[i].Index = i
+		if r.Err != nil {
+			resp[i].Error = r.Err.Error()
+			continue
+		}
+		succeeded++
+		resp[i].ShortID = r.Link.ShortID
+		resp[i].ShortURL = h.svc.ShortURL(r.Link.ShortID)
+		resp[i].ExpiresAt = r.Link.ExpiresAt
+		resp[i].Reused = r.Reused
+		if r.Reused {
+			reused++
+		}
+	}
+	metrics.ShortenCounter.Add(float64(succeeded - reused))
+	span.SetAttributes(attribute.Int("succeeded", succeeded), attribute.Int("failed", len(results)-succeeded))
+
+	status := http.StatusOK
+	if body.AllOrNothing && succeeded < len(results) {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, gin.H{"results": resp, "succeeded": succeeded, "failed": len(results) - succeeded})
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/middleware"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type batchResponse struct {
+	Results   []batchItemResult `json:"results"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+}
+
+func postBatch(t *testing.T, r *gin.Engine, body string) (int, batchResponse) {
+	req := httptest.NewRequest(http.MethodPost, "/shorten/batch", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer testtoken123")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	var out batchResponse
+	if resp.Code == http.StatusOK || resp.Code == http.StatusUnprocessableEntity {
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &out))
+	}
+	return resp.Code, out
+}
+
+func TestShortenBatchHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	store := repository.NewMemoryLinkStore()
+	cache := repository.NewMemoryCache()
+	require.NoError(t, store.Create(ctx, &repository.URLMapping{ShortID: "taken", LongURL: "https://example.com", Created: time.Now()}))
+	h := NewURLHandler(service.NewShortener(store, cache, service.WithMaxBatchSize(5)))
+
+	r := gin.New()
+	r.Use(middleware.AuthMiddleware(testKeys()))
+	r.POST("/shorten/batch", h.HandleShortenBatch)
+
+	code, out := postBatch(t, r, `{"items": [
+		{"url": "https://example.com/a"},
+		{"url": "not a url"},
+		{"url": "https://example.com/b", "alias": "taken"},
+		{"url": "https://example.com/c", "alias": "fresh-one", "ttl_seconds": 60},
+		{"url": "https://example.com/d", "alias": "fresh-one"}
+	]}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, out.Succeeded)
+	assert.Equal(t, 3, out.Failed)
+	assert.NotEmpty(t, out.Results[0].ShortID)
+	assert.Equal(t, "invalid url", out.Results[1].Error)
+	assert.Equal(t, service.ErrAliasTaken.Error(), out.Results[2].Error)
+	assert.Equal(t, "fresh-one", out.Results[3].ShortID)
+	assert.NotNil(t, out.Results[3].ExpiresAt)
+	assert.Equal(t, service.ErrAliasTaken.Error(), out.Results[4].Error)
+
+	cached, err := cache.Get(ctx, "fresh-one")
+	require.NoError(t, err)
+	assert.Contains(t, cached, "https://example.com/c")
+
+	code, out = postBatch(t, r, `{"all_or_nothing": true, "items": [
+		{"url": "https://example.com/e", "alias": "atomic-1"},
+		{"url": "https://example.com/f", "alias": "taken"}
+	]}`)
+	require.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, 0, out.Succeeded)
+	assert.Equal(t, service.ErrBatchAborted.Error(), out.Results[0].Error)
+	assert.Equal(t, service.ErrAliasTaken.Error(), out.Results[1].Error)
+	_, err = store.Get(ctx, "atomic-1")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	code, _ = postBatch(t, r, `{"items": [{"url": "https://a.example"}, {"url": "https://b.example"}, {"url": "https://c.example"}, {"url": "https://d.example"}, {"url": "https://e.example"}, {"url": "https://f.example"}]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+// standaloneStore stands in for a Mongo server without transactions.
+type standaloneStore struct {
+	*repository.MemoryLinkStore
+}
+
+func (s standaloneStore) CreateMany(ctx context.Context, links []*repository.URLMapping, atomic bool) ([]error, error) {
+	if atomic {
+		return nil, repository.ErrAtomicUnsupported
+	}
+	errs := make([]error, len(links))
+	for i, m := range links {
+		errs[i] = s.Create(ctx, m)
+	}
+	return errs, nil
+}
+
+func TestShortenBatchHandler_AtomicUnsupported(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := standaloneStore{repository.NewMemoryLinkStore()}
+	h := NewURLHandler(service.NewShortener(store, repository.NewMemoryCache()))
+
+	r := gin.New()
+	r.Use(middleware.AuthMiddleware(testKeys()))
+	r.POST("/shorten/batch", h.HandleShortenBatch)
+
+	code, _ := postBatch(t, r, `{"items": [{"url": "https://example.com/a", "alias": "first"}], "all_or_nothing": true}`)
+	assert.Equal(t, http.StatusNotImplemented, code)
+	_, err := store.Get(context.Background(), "first")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	code, out := postBatch(t, r, `{"items": [{"url": "https://example.com/a", "alias": "first"}]}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, out.Succeeded)
+}
+
+func TestShortenBatchHandler_PasswordLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := repository.NewMemoryLinkStore()
+	h := NewURLHandler(service.NewShortener(store, repository.NewMemoryCache(), service.WithMaxBatchPasswords(2)))
+
+	r := gin.New()
+	r.Use(middleware.AuthMiddleware(testKeys()))
+	r.POST("/shorten/batch", h.HandleShortenBatch)
+
+	code, _ := postBatch(t, r, `{"items": [
+		{"url": "https://example.com/a", "alias": "locked-a", "password": "hunter22"},
+		{"url": "https://example.com/b", "alias": "locked-b", "password": "hunter22"},
+		{"url": "https://example.com/c", "alias": "locked-c", "password": "hunter22"},
+		{"url": "https://example.com/d", "alias": "open-d"}
+	]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, err := store.Get(context.Background(), "open-d")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	code, out := postBatch(t, r, `{"items": [
+		{"url": "https://example.com/a", "alias": "locked-a", "password": "hunter22"},
+		{"url": "https://example.com/b", "alias": "locked-b", "password": "hunter22"},
+		{"url": "https://example.com/d", "alias": "open-d"}
+	]}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 3, out.Succeeded)
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/domainlist"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type domainRuleBody struct {
+	// Action is "block" (the default) or "allow".
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
+// DomainHandler exposes the domain rules stored in the database. Rules from
+// the domain list file are read-only and not listed.
+type DomainHandler struct {
+	store repository.DomainStore
+	list  *domainlist.List
+}
+
+func NewDomainHandler(store repository.DomainStore, list *domainlist.List) *DomainHandler {
+	return &DomainHandler{store: store, list: list}
+}
+
+func (h *DomainHandler) HandleList(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandleListDomains")
+	defer span.End()
+
+	rules, err := h.store.ListDomainRules(ctx)
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to list domain rules")
+		span.RecordError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+func (h *DomainHandler) HandlePut(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandlePutDomain")
+	defer span.End()
+
+	domain, err := domainlist.NormalizeDomain(c.Param("domain"))
+	if err != nil {
+		span.SetStatus(codes.Error, "invalid domain")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var body domainRuleBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		span.SetStatus(codes.Error, "invalid request body")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	switch body.Action {
+	case "":
+		body.Action = repository.DomainBlock
+	case repository.DomainBlock, repository.DomainAllow:
+	default:
+		span.SetStatus(codes.Error, "invalid action")
+		c.JSON(http.StatusBadRequest, gin.H{"error": `action must be "block" or "allow"`})
+		return
+	}
+
+	rule := repository.DomainRule{Domain: domain, Action: body.Action, Reason: body.Reason, CreatedAt: time.Now().UTC()}
+	if err := h.store.PutDomainRule(ctx, &rule); err != nil {
+		span.SetStatus(codes.Error, "failed to save domain rule")
+		span.RecordError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.reload(c)
+
+	span.SetAttributes(attribute.String("domain", domain), attribute.String("action", rule.Action))
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *DomainHandler) HandleDelete(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandleDeleteDomain")
+	defer span.End()
+
+	domain, err := domainlist.NormalizeDomain(c.Param("domain"))
+	if err != nil {
+		span.SetStatus(codes.Error, "invalid domain")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err = h.store.DeleteDomainRule(ctx, domain)
+	if errors.Is(err, repository.ErrNotFound) {
+		span.SetStatus(codes.Error, "domain rule not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": "domain rule not found"})
+		return
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to delete domain rule")
+		span.RecordError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.reload(c)
+
+	span.SetAttributes(attribute.String("domain", domain))
+	c.JSON(http.StatusOK, gin.H{"message": "domain rule deleted successfully"})
+}
+
+// reload applies a change on this instance right away; other instances pick
+// it up on their next periodic reload.
+func (h *DomainHandler) reload(c *gin.Context) {
+	if err := h.list.Reload(c.Request.Context()); err != nil {
+		logger.Log.Warnf("Domain list reload error: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/domainlist"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/middleware"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+)
+
+func TestDomainRules_BlockShortenAndRedirect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	store := repository.NewMemoryLinkStore()
+	require.NoError(t, store.Create(ctx, &repository.URLMapping{ShortID: "old-link", LongURL: "https://login.phish.example/account", Created: time.Now()}))
+
+	rules := repository.NewMemoryDomainStore()
+	list := domainlist.New(domainlist.StoreSource{Store: rules})
+	h := NewURLHandler(service.NewShortener(store, repository.NewMemoryCache(), service.WithDomainList(list)))
+	domains := NewDomainHandler(rules, list)
+
+	keys := testKeys()
+	r := gin.New()
+	r.GET("/:shortID", h.HandleRedirect)
+	r.POST("/shorten", h.HandleShorten)
+	admin := r.Group("/admin", middleware.AuthMiddleware(keys), middleware.RequireAdmin())
+	admin.GET("/domains", domains.HandleList)
+	admin.PUT("/domains/:domain", domains.HandlePut)
+	admin.DELETE("/domains/:domain", domains.HandleDelete)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer testtoken123")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	assert.Equal(t, http.StatusMovedPermanently, send(http.MethodGet, "/old-link", "").Code)
+
+	resp := send(http.MethodPut, "/admin/domains/Phish.Example", `{"reason": "credential phishing"}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Contains(t, resp.Body.String(), `"domain":"phish.example"`)
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodPut, "/admin/domains/ok.example", `{"action": "maybe"}`).Code)
+
+	resp = send(http.MethodGet, "/old-link", "")
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Contains(t, resp.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, resp.Body.String(), "credential phishing")
+	assert.Empty(t, resp.Header().Get("Location"))
+
+	resp = send(http.MethodPost, "/shorten", `{"url": "https://www.phish.example/"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	assert.Contains(t, resp.Body.String(), "blocked_domain")
+
+	require.Equal(t, http.StatusOK, send(http.MethodPut, "/admin/domains/safe.phish.example", `{"action": "allow"}`).Code)
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, "/shorten", `{"url": "https://safe.phish.example/"}`).Code)
+
+	assert.Contains(t, send(http.MethodGet, "/admin/domains", "").Body.String(), "safe.phish.example")
+	assert.Equal(t, http.StatusOK, send(http.MethodDelete, "/admin/domains/phish.example", "").Code)
+	assert.Equal(t, http.StatusNotFound, send(http.MethodDelete, "/admin/domains/phish.example", "").Code)
+	assert.Equal(t, http.StatusMovedPermanently, send(http.MethodGet, "/old-link", "").Code)
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/analytics"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+)
+
+type fakeLocator map[string]string
+
+func (l fakeLocator) Country(ip string) string {
+	return l[ip]
+}
+
+func TestGeoTargeting(t *testing.T) {
+	require.NoError(t, logger.InitLogger())
+	gin.SetMode(gin.TestMode)
+	clicks := repository.NewMemoryClickStore()
+	recorder := analytics.NewRecorder(clicks, "salt", 10, 100, time.Hour)
+	recorder.Start()
+	svc := service.NewShortener(repository.NewMemoryLinkStore(), repository.NewMemoryCache(),
+		service.WithGeoIP(fakeLocator{"81.2.69.142": "GB", "200.160.2.3": "BR"}))
+	h := NewURLHandler(svc, WithClickRecorder(recorder))
+	r := gin.New()
+	r.POST("/shorten", h.HandleShorten)
+	r.GET("/:shortID", h.HandleRedirect)
+
+	req := httptest.NewRequest(http.MethodPost, "/shorten", bytes.NewBufferString(`{"url": "https://shop.example.com/", "alias": "store", "rules": [
+		{"countries": ["gb", "IE"], "long_url": "https://shop.example.co.uk/"},
+		{"countries": ["BR"], "long_url": "https://shop.example.com.br/"}
+	]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	for ip, want := range map[string]string{
+		"81.2.69.142": "https://shop.example.co.uk/",
+		"200.160.2.3": "https://shop.example.com.br/",
+		"192.0.2.1":   "https://shop.example.com/",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/store", nil)
+		req.RemoteAddr = ip + ":12345"
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		assert.Equal(t, want, resp.Header().Get("Location"), ip)
+	}
+
+	recorder.Close(context.Background())
+	events, err := clicks.ListClicks(context.Background(), "store", time.Now().Add(-time.Minute), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	countries := map[string]int{}
+	for _, ev := range events {
+		countries[ev.Country]++
+	}
+	assert.Equal(t, map[string]int{"GB": 1, "BR": 1, "": 1}, countries)
+
+	req = httptest.NewRequest(http.MethodPost, "/shorten", bytes.NewBufferString(`{"url": "https://shop.example.com/", "rules": [{"countries": ["GBR"], "long_url": "https://shop.example.co.uk/"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestGeoTargeting_ForwardedHeaders(t *testing.T) {
+	require.NoError(t, logger.InitLogger())
+	gin.SetMode(gin.TestMode)
+	svc := service.NewShortener(repository.NewMemoryLinkStore(), repository.NewMemoryCache(),
+		service.WithGeoIP(fakeLocator{"81.2.69.142": "GB", "200.160.2.3": "BR"}))
+	h := NewURLHandler(svc)
+	r := gin.New()
+	require.NoError(t, r.SetTrustedProxies([]string{"10.0.0.1"}))
+	r.POST("/shorten", h.HandleShorten)
+	r.GET("/:shortID", h.HandleRedirect)
+
+	req := httptest.NewRequest(http.MethodPost, "/shorten", bytes.NewBufferString(`{"url": "https://shop.example.com/", "alias": "store", "rules": [
+		{"countries": ["GB"], "long_url": "https://shop.example.co.uk/"}
+	]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	location := func(peer string, headers map[string]string) string {
+		req := httptest.NewRequest(http.MethodGet, "/store", nil)
+		req.RemoteAddr = peer + ":12345"
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp.Header().Get("Location")
+	}
+
+	// A client that is not a trusted proxy cannot claim a country.
+	assert.Equal(t, "https://shop.example.com/", location("192.0.2.1", map[string]string{"X-Forwarded-For": "81.2.69.142"}))
+	assert.Equal(t, "https://shop.example.com/", location("192.0.2.1", map[string]string{"X-Real-IP": "81.2.69.142"}))
+	assert.Equal(t, "https://shop.example.com/", location("200.160.2.3", map[string]string{"X-Forwarded-For": "81.2.69.142"}))
+
+	// Behind the trusted proxy, the forwarded client is located.
+	assert.Equal(t, "https://shop.example.co.uk/", location("10.0.0.1", map[string]string{"X-Forwarded-For": "81.2.69.142"}))
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/auth"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type keyBody struct {
+	Owner     string     `json:"owner" binding:"required"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	Admin     bool       `json:"admin"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// keyResponse is an API key as shown to admins; the hash never leaves the
+// server and the token is only set right after creation or rotation.
+type keyResponse struct {
+	ID         string     `json:"id"`
+	Token      string     `json:"token,omitempty"`
+	Owner      string     `json:"owner"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Admin      bool       `json:"admin"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func newKeyResponse(key *auth.APIKey, token string) keyResponse {
+	return keyResponse{
+		ID:         key.ID,
+		Token:      token,
+		Owner:      key.Owner,
+		Name:       key.Name,
+		Scopes:     key.Scopes,
+		Admin:      key.Admin,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
+
+// KeyHandler exposes API key administration.
+type KeyHandler struct {
+	keys *auth.KeyManager
+}
+
+func NewKeyHandler(keys *auth.KeyManager) *KeyHandler {
+	return &KeyHandler{keys: keys}
+}
+
+func (h *KeyHandler) HandleCreate(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandleCreateKey")
+	defer span.End()
+
+	var body keyBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		span.SetStatus(codes.Error, "invalid request body")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	token, key, err := h.keys.Create(ctx, auth.KeySpec{
+		Owner:     body.Owner,
+		Name:      body.Name,
+		Scopes:    body.Scopes,
+		Admin:     body.Admin,
+		ExpiresAt: body.ExpiresAt,
+	})
+	if errors.Is(err, auth.ErrInvalidScope) || errors.Is(err, auth.ErrMissingOwner) {
+		span.SetStatus(codes.Error, "invalid key spec")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to create key")
+		span.RecordError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	span.SetAttributes(attribute.String("key_id", key.ID), attribute.String("owner", key.Owner))
+	c.JSON(http.StatusCreated, newKeyResponse(key, token))
+}
+
+func (h *KeyHandler) HandleList(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandleListKeys")
+	defer span.End()
+
+	keys, err := h.keys.List(ctx, c.Query("owner"))
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to list keys")
+		span.RecordError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := make([]keyResponse, len(keys))
+	for i := range keys {
+		resp[i] = newKeyResponse(&keys[i], "")
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": resp})
+}
+
+func (h *KeyHandler) HandleRotate(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandleRotateKey")
+	defer span.End()
+
+	keyID := c.Param("keyID")
+	token, key, err := h.keys.Rotate(ctx, keyID)
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to rotate key")
+		span.RecordError(err)
+		c.JSON(keyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	span.SetAttributes(attribute.String("key_id", keyID))
+	c.JSON(http.StatusOK, newKeyResponse(key, token))
+}
+
+func (h *KeyHandler) HandleRevoke(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandleRevokeKey")
+	defer span.End()
+
+	keyID := c.Param("keyID")
+	key, err := h.keys.Revoke(ctx, keyID)
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to revoke key")
+		span.RecordError(err)
+		c.JSON(keyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	span.SetAttributes(attribute.String("key_id", keyID))
+	c.JSON(http.StatusOK, newKeyResponse(key, ""))
+}
+
+func keyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, auth.ErrKeyRevoked):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
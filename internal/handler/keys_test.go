@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/auth"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKeysRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	keys := testKeys()
+	kh := NewKeyHandler(keys)
+
+	r := gin.New()
+	admin := r.Group("/admin", middleware.AuthMiddleware(keys), middleware.RequireAdmin())
+	admin.POST("/keys", kh.HandleCreate)
+	admin.GET("/keys", kh.HandleList)
+	admin.POST("/keys/:keyID/rotate", kh.HandleRotate)
+	admin.DELETE("/keys/:keyID", kh.HandleRevoke)
+
+	protected := r.Group("/", middleware.AuthMiddleware(keys))
+	protected.POST("/shorten", middleware.RequireScope(auth.ScopeLinksWrite), func(c *gin.Context) {
+		c.JSON(http.StatusOK, middleware.Principal(c))
+	})
+	return r
+}
+
+func doJSON(r *gin.Engine, method, path, token string, body any) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req, _ := http.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestKeyHandler_Lifecycle(t *testing.T) {
+	r := newKeysRouter()
+
+	w := doJSON(r, http.MethodPost, "/admin/keys", "testtoken123", gin.H{
+		"owner": "team-a", "name": "ci", "scopes": []string{auth.ScopeLinksWrite},
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created keyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.Token)
+	assert.NotContains(t, w.Body.String(), "hash")
+
+	w = doJSON(r, http.MethodPost, "/shorten", created.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var principal auth.Principal
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &principal))
+	assert.Equal(t, "team-a", principal.Owner)
+	assert.Equal(t, created.ID, principal.KeyID)
+
+	assert.Equal(t, http.StatusForbidden, doJSON(r, http.MethodGet, "/admin/keys", created.Token, nil).Code)
+
+	w = doJSON(r, http.MethodPost, "/admin/keys/"+created.ID+"/rotate", "testtoken123", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var rotated keyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+	assert.Equal(t, created.ID, rotated.ID)
+	assert.Equal(t, http.StatusUnauthorized, doJSON(r, http.MethodPost, "/shorten", created.Token, nil).Code)
+	assert.Equal(t, http.StatusOK, doJSON(r, http.MethodPost, "/shorten", rotated.Token, nil).Code)
+
+	assert.Equal(t, http.StatusOK, doJSON(r, http.MethodDelete, "/admin/keys/"+created.ID, "testtoken123", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, doJSON(r, http.MethodPost, "/shorten", rotated.Token, nil).Code)
+}
+
+func TestKeyHandler_ScopeAndValidation(t *testing.T) {
+	r := newKeysRouter()
+
+	w := doJSON(r, http.MethodPost, "/admin/keys", "testtoken123", gin.H{"owner": "team-a", "scopes": []string{"links:everything"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(r, http.MethodPost, "/admin/keys", "testtoken123", gin.H{"owner": "team-a", "scopes": []string{auth.ScopeStatsRead}})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created keyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, http.StatusForbidden, doJSON(r, http.MethodPost, "/shorten", created.Token, nil).Code)
+
+	assert.Equal(t, http.StatusNotFound, doJSON(r, http.MethodPost, "/admin/keys/missing/rotate", "testtoken123", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, doJSON(r, http.MethodGet, "/admin/keys", "sk_nope_nope", nil).Code)
+}
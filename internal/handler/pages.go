@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+// pages are the HTML pages served to visitors instead of a redirect.
+var pages = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+// renderPage writes the named template with data. Pages are never cached.
+func renderPage(c *gin.Context, status int, name string, data any) {
+	var buf bytes.Buffer
+	if err := pages.ExecuteTemplate(&buf, name, data); err != nil {
+		logger.Log.Errorf("Template %s error: %v", name, err)
+		c.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// HandleUnlock serves POST /:shortID, the password form of a protected link,
+// and redirects with 303 See Other once the password matches.
+func (h *URLHandler) HandleUnlock(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandleUnlock")
+	defer span.End()
+
+	shortID := c.Param("shortID")
+	res, err := h.svc.UnlockShortID(ctx, shortID, c.PostForm("password"), visitFor(c))
+	switch {
+	case errors.Is(err, service.ErrWrongPassword):
+		span.SetStatus(codes.Error, "wrong password")
+		renderPage(c, http.StatusUnauthorized, "password.html", gin.H{"Error": "Senha incorreta."})
+		return
+	case errors.Is(err, service.ErrTooManyAttempts):
+		span.SetStatus(codes.Error, "too many password attempts")
+		renderPage(c, http.StatusTooManyRequests, "password.html", gin.H{"Error": "Muitas tentativas. Tente novamente mais tarde."})
+		return
+	case err != nil:
+		writeResolveError(c, span, err)
+		return
+	}
+
+	metrics.RedirectCounter.Inc()
+	h.recordClick(c, shortID, res.Country)
+	setVariantCookie(c, shortID, res.Variant)
+	span.SetAttributes(attribute.String("short_id", shortID))
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusSeeOther, res.LongURL)
+}
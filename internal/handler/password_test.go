@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/ratelimit"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+)
+
+func TestPasswordProtectedLink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := repository.NewMemoryLinkStore()
+	svc := service.NewShortener(store, repository.NewMemoryCache(),
+		service.WithPasswordAttemptLimit(ratelimit.NewMemoryLimiter(), ratelimit.Limit{Requests: 3, Window: time.Minute}))
+	h := NewURLHandler(svc)
+	r := gin.New()
+	r.POST("/shorten", h.HandleShorten)
+	r.GET("/stats/:shortID", h.HandleStats)
+	r.GET("/:shortID", h.HandleRedirect)
+	r.POST("/:shortID", h.HandleUnlock)
+
+	req := httptest.NewRequest(http.MethodPost, "/shorten", bytes.NewBufferString(`{"url": "https://docs.example.com/secret", "alias": "secret-doc", "password": "hunter22",
+		"rules": [{"platforms": ["ios"], "long_url": "https://docs.example.com/secret-ios"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	// The second visit is served from the cache and must still ask for the password.
+	for i := 0; i < 2; i++ {
+		resp = httptest.NewRecorder()
+		r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/secret-doc", nil))
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Body.String(), `<form method="post">`)
+		assert.NotContains(t, resp.Body.String(), "docs.example.com")
+		assert.Empty(t, resp.Header().Get("Location"))
+	}
+
+	unlock := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/secret-doc", strings.NewReader(url.Values{"password": {password}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, unlock("wrong").Code)
+	resp = unlock("hunter22")
+	assert.Equal(t, http.StatusSeeOther, resp.Code)
+	assert.Equal(t, "https://docs.example.com/secret", resp.Header().Get("Location"))
+
+	assert.Equal(t, http.StatusUnauthorized, unlock("wrong").Code)
+	assert.Equal(t, http.StatusTooManyRequests, unlock("hunter22").Code)
+
+	link, err := store.Get(req.Context(), "secret-doc")
+	require.NoError(t, err)
+	assert.Equal(t, 1, link.AccessCount)
+	assert.True(t, link.Protected())
+
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/stats/secret-doc", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.NotContains(t, resp.Body.String(), "password_hash")
+	// Anonymous stats must not give away what the password protects.
+	assert.NotContains(t, resp.Body.String(), "docs.example.com")
+	assert.NotContains(t, resp.Body.String(), `"rules"`)
+	assert.Contains(t, resp.Body.String(), `"access_count":1`)
+}
+
+func TestPasswordAttempts_SpoofedForwardingHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc := service.NewShortener(repository.NewMemoryLinkStore(), repository.NewMemoryCache(),
+		service.WithPasswordAttemptLimit(ratelimit.NewMemoryLimiter(), ratelimit.Limit{Requests: 3, Window: time.Minute}))
+	h := NewURLHandler(svc)
+	r := gin.New()
+	require.NoError(t, r.SetTrustedProxies(nil))
+	r.POST("/shorten", h.HandleShorten)
+	r.POST("/:shortID", h.HandleUnlock)
+
+	req := httptest.NewRequest(http.MethodPost, "/shorten", bytes.NewBufferString(`{"url": "https://docs.example.com/secret", "alias": "secret-doc", "password": "hunter22"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	unlock := func(password, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/secret-doc", strings.NewReader(url.Values{"password": {password}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.Header.Set("X-Real-IP", forwardedFor)
+		req.RemoteAddr = "203.0.113.7:1234"
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	// Every forged address draws from the budget of the real peer.
+	for i, ip := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"} {
+		assert.Equal(t, http.StatusUnauthorized, unlock("wrong", ip), i)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, unlock("hunter22", "198.51.100.4"))
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/auth"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// previewPage is the data of templates/preview.html.
+type previewPage struct {
+	ShortURL string
+	LongURL  string
+	Domain   string
+	Created  time.Time
+	// AccessCount is nil when the stats are private to the visitor.
+	AccessCount  *int
+	ExpiresAt    *time.Time
+	Interstitial bool
+	// Action is where the continue button posts to.
+	Action string
+}
+
+func (h *URLHandler) newPreviewPage(link *repository.URLMapping, caller service.Caller, interstitial bool) previewPage {
+	page := previewPage{
+		ShortURL:     h.svc.ShortURL(link.ShortID),
+		Action:       h.svc.ShortURL(link.ShortID),
+		LongURL:      link.LongURL,
+		Domain:       repository.DestinationDomain(link.LongURL),
+		Created:      link.Created,
+		ExpiresAt:    link.ExpiresAt,
+		Interstitial: interstitial,
+	}
+	if caller.CanReadStats(link) {
+		page.AccessCount = &link.AccessCount
+	}
+	return page
+}
+
+// HandlePreview serves GET /preview/:shortID, which shows where a link goes
+// without following it. Appending "+" to a short URL does the same.
+func (h *URLHandler) HandlePreview(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandlePreview")
+	defer span.End()
+	c.Request = c.Request.WithContext(ctx)
+	h.preview(c, span, c.Param("shortID"))
+}
+
+func (h *URLHandler) preview(c *gin.Context, span trace.Span, shortID string) {
+	caller := callerFor(c, auth.ScopeStatsRead)
+	link, err := h.svc.PreviewShortID(c.Request.Context(), shortID, caller)
+	if errors.Is(err, service.ErrPasswordRequired) {
+		span.SetStatus(codes.Error, "password required")
+		renderPage(c, http.StatusOK, "password.html", gin.H{"Action": h.svc.ShortURL(shortID)})
+		return
+	}
+	if err != nil {
+		writeResolveError(c, span, err)
+		return
+	}
+
+	span.SetAttributes(attribute.String("short_id", shortID))
+	renderPage(c, http.StatusOK, "preview.html", h.newPreviewPage(link, caller, false))
+}
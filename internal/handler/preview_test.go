@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/middleware"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+)
+
+func TestPreviewAndInterstitial(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := repository.NewMemoryLinkStore()
+	svc := service.NewShortener(store, repository.NewMemoryCache())
+	h := NewURLHandler(svc)
+	r := gin.New()
+	r.POST("/shorten", h.HandleShorten)
+	r.GET("/preview/:shortID", middleware.OptionalAuthMiddleware(testKeys()), h.HandlePreview)
+	r.GET("/:shortID", h.HandleRedirect)
+	r.POST("/:shortID", h.HandleUnlock)
+
+	shorten := func(body string) {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	}
+	get := func(method, path string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, httptest.NewRequest(method, path, nil))
+		return resp
+	}
+	clicks := func(id string) int {
+		link, err := store.Get(context.Background(), id)
+		require.NoError(t, err)
+		return link.AccessCount
+	}
+
+	shorten(`{"url": "https://example.com/report?q=1", "alias": "report"}`)
+	assert.Equal(t, http.StatusMovedPermanently, get(http.MethodGet, "/report").Code)
+
+	for _, path := range []string{"/preview/report", "/report+"} {
+		resp := get(http.MethodGet, path)
+		assert.Equal(t, http.StatusOK, resp.Code, path)
+		assert.Contains(t, resp.Body.String(), "https://example.com/report?q=1", path)
+		assert.Contains(t, resp.Body.String(), "<dd>1</dd>", path)
+		assert.Empty(t, resp.Header().Get("Location"), path)
+	}
+	assert.Equal(t, 1, clicks("report"))
+	assert.Equal(t, http.StatusNotFound, get(http.MethodGet, "/preview/missing").Code)
+
+	// Interstitial links show the page on every visit and count the click
+	// when the visitor continues.
+	shorten(`{"url": "https://example.com/download", "alias": "download", "interstitial": true}`)
+	resp := get(http.MethodGet, "/download")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "https://example.com/download")
+	assert.Contains(t, resp.Body.String(), `action="http://localhost:8080/download"`)
+	assert.Equal(t, 0, clicks("download"))
+
+	resp = get(http.MethodPost, "/download")
+	assert.Equal(t, http.StatusSeeOther, resp.Code)
+	assert.Equal(t, "https://example.com/download", resp.Header().Get("Location"))
+	assert.Equal(t, 1, clicks("download"))
+
+	// The page shows where this visitor goes, after rules and UTM.
+	shorten(`{"url": "https://example.com/app", "alias": "app", "interstitial": true, "utm": {"source": "qr"},
+		"rules": [{"languages": ["pt"], "long_url": "https://example.com.br/app"}]}`)
+	visit := func(method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/app", nil)
+		req.Header.Set("Accept-Language", "pt-BR,pt;q=0.9")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+	resp = visit(http.MethodGet)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "https://example.com.br/app?utm_source=qr")
+	assert.NotContains(t, resp.Body.String(), "https://example.com/app")
+	assert.Contains(t, get(http.MethodGet, "/app").Body.String(), "https://example.com/app?utm_source=qr")
+	assert.Equal(t, "https://example.com.br/app?utm_source=qr", visit(http.MethodPost).Header().Get("Location"))
+
+	// Private counters are only shown to callers that may read the stats.
+	shorten(`{"url": "https://example.com/private", "alias": "private", "private_stats": true}`)
+	shorten(`{"url": "https://example.com/private-gate", "alias": "private-gate", "private_stats": true, "interstitial": true}`)
+	get(http.MethodGet, "/private")
+	get(http.MethodPost, "/private-gate")
+	for _, path := range []string{"/preview/private", "/private+", "/private-gate"} {
+		resp := get(http.MethodGet, path)
+		assert.Equal(t, http.StatusOK, resp.Code, path)
+		assert.Contains(t, resp.Body.String(), "https://example.com/private", path)
+		assert.NotContains(t, resp.Body.String(), "Cliques", path)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/preview/private", nil)
+	req.Header.Set("Authorization", "Bearer testtoken123")
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Contains(t, resp.Body.String(), "<dd>1</dd>")
+
+	// Previews of protected links ask for the password first.
+	shorten(`{"url": "https://docs.example.com/secret", "alias": "secret", "password": "hunter22"}`)
+	resp = get(http.MethodGet, "/preview/secret")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotContains(t, resp.Body.String(), "docs.example.com")
+	assert.Contains(t, resp.Body.String(), `action="http://localhost:8080/secret"`)
+}
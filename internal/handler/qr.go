@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/qr"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// qrMaxAge is how long clients may cache a QR code of a link without expiry.
+const qrMaxAge = 24 * time.Hour
+
+// QRHandler serves QR codes of short links.
+type QRHandler struct {
+	svc *service.Shortener
+	gen *qr.Generator
+}
+
+func NewQRHandler(svc *service.Shortener, gen *qr.Generator) *QRHandler {
+	return &QRHandler{svc: svc, gen: gen}
+}
+
+// HandleQR serves GET /qr/:shortID. Query parameters: format (png|svg), size
+// in pixels, level (L|M|Q|H), margin in modules, fg and bg as hex colors and
+// logo (true|false). Codes are only served for links that can be followed.
+func (h *QRHandler) HandleQR(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandleQR")
+	defer span.End()
+
+	opts, err := qr.ParseOptions(c.Request.URL.Query())
+	if err != nil {
+		span.SetStatus(codes.Error, "invalid QR code options")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	shortID := c.Param("shortID")
+	link, err := h.svc.LiveLink(ctx, shortID)
+	if err != nil {
+		writeResolveError(c, span, err)
+		return
+	}
+
+	img, hit, err := h.gen.Generate(h.svc.ShortURL(shortID), opts)
+	if errors.Is(err, qr.ErrInvalidOptions) {
+		span.SetStatus(codes.Error, "invalid QR code options")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		span.SetStatus(codes.Error, "failed to render QR code")
+		span.RecordError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render QR code"})
+		return
+	}
+	metrics.QRCodes.WithLabelValues(string(opts.Format), strconv.FormatBool(hit)).Inc()
+
+	// Never let clients keep the image past the link's expiry.
+	maxAge := qrMaxAge
+	if link.ExpiresAt != nil {
+		maxAge = min(maxAge, time.Until(*link.ExpiresAt))
+	}
+	sum := sha256.Sum256(img)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+
+	span.SetAttributes(
+		attribute.String("short_id", shortID),
+		attribute.String("format", string(opts.Format)),
+		attribute.Bool("cache_hit", hit),
+	)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, opts.Format.ContentType(), img)
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/qr"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+)
+
+func TestHandleQR(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc := service.NewShortener(repository.NewMemoryLinkStore(), repository.NewMemoryCache())
+	h := NewURLHandler(svc)
+	qrHandler := NewQRHandler(svc, qr.NewGenerator(nil, 16))
+	r := gin.New()
+	r.POST("/shorten", h.HandleShorten)
+	r.GET("/qr/:shortID", qrHandler.HandleQR)
+
+	req := httptest.NewRequest(http.MethodPost, "/shorten", bytes.NewBufferString(`{"url": "https://example.com/campaign", "alias": "campaign", "ttl_seconds": 600}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	get := func(path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp = get("/qr/campaign?size=300")
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Equal(t, "image/png", resp.Header().Get("Content-Type"))
+	img, err := png.Decode(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 300, img.Bounds().Dx())
+	// Clients must not cache the code past the link's expiry.
+	assert.Regexp(t, `^public, max-age=(599|600)$`, resp.Header().Get("Cache-Control"))
+
+	etag := resp.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, http.StatusNotModified, get("/qr/campaign?size=300", "If-None-Match", etag).Code)
+
+	resp = get("/qr/campaign?format=svg&fg=%23003366")
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "image/svg+xml", resp.Header().Get("Content-Type"))
+	assert.Contains(t, resp.Body.String(), `fill="#003366"`)
+
+	assert.Equal(t, http.StatusBadRequest, get("/qr/campaign?level=Z").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/qr/campaign?logo=true").Code)
+	assert.Equal(t, http.StatusNotFound, get("/qr/missing").Code)
+}
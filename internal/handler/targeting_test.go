@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+)
+
+const (
+	iPhoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+	androidUA = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36"
+	desktopUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+)
+
+func TestTargetingRules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc := service.NewShortener(repository.NewMemoryLinkStore(), repository.NewMemoryCache())
+	h := NewURLHandler(svc)
+	r := gin.New()
+	r.POST("/shorten", h.HandleShorten)
+	r.GET("/:shortID", h.HandleRedirect)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+	visit := func(id, ua, lang string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/"+id, nil)
+		req.Header.Set("User-Agent", ua)
+		req.Header.Set("Accept-Language", lang)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	resp := post(`{"url": "https://example.com/app", "alias": "get-app", "rules": [
+		{"platforms": ["ios"], "long_url": "https://apps.apple.com/app/id1"},
+		{"platforms": ["Android"], "languages": ["pt"], "long_url": "https://play.google.com/store/apps/details?id=app&hl=pt"},
+		{"platforms": ["android"], "long_url": "https://play.google.com/store/apps/details?id=app"},
+		{"until": "` + past + `", "long_url": "https://example.com/old-campaign"}
+	]}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	for _, tc := range []struct{ ua, lang, want string }{
+		{iPhoneUA, "en-US", "https://apps.apple.com/app/id1"},
+		{androidUA, "pt-BR,pt;q=0.9,en;q=0.8", "https://play.google.com/store/apps/details?id=app&hl=pt"},
+		{androidUA, "en-US,pt;q=0.5", "https://play.google.com/store/apps/details?id=app"},
+		{desktopUA, "pt-BR", "https://example.com/app"},
+	} {
+		resp := visit("get-app", tc.ua, tc.lang)
+		assert.Equal(t, tc.want, resp.Header().Get("Location"), tc.ua)
+		assert.Equal(t, "private, no-cache, no-store, must-revalidate", resp.Header().Get("Cache-Control"))
+	}
+
+	for _, body := range []string{
+		`{"url": "https://example.com/", "rules": [{"long_url": "https://example.com/x"}]}`,
+		`{"url": "https://example.com/", "rules": [{"platforms": ["amiga"], "long_url": "https://example.com/x"}]}`,
+		`{"url": "https://example.com/", "rules": [{"languages": ["p t"], "long_url": "https://example.com/x"}]}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, post(body).Code, body)
+	}
+	resp = post(`{"url": "https://example.com/", "rules": [{"platforms": ["ios"], "long_url": "javascript:alert(1)"}]}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	assert.Contains(t, resp.Body.String(), "rule 0:")
+}
@@ -1,24 +1,110 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/analytics"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/auth"
 	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/middleware"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
 	"github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/urlpolicy"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type reqBody struct {
-	URL string `json:"url" binding:"required,url"`
+	URL          string     `json:"url" binding:"required,url"`
+	Alias        string     `json:"alias"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	TTLSeconds   int64      `json:"ttl_seconds"`
+	MaxClicks    int        `json:"max_clicks"`
+	RedirectType int        `json:"redirect_type"`
+	PrivateStats bool       `json:"private_stats"`
+	Tags         []string   `json:"tags"`
+	// ReuseExisting returns the caller's existing link to the same
+	// destination, if any, instead of creating a new one.
+	ReuseExisting bool `json:"reuse_existing"`
+	// Password must be entered by visitors before they are redirected.
+	Password string `json:"password"`
+	// Interstitial shows the preview page on every visit.
+	Interstitial bool `json:"interstitial"`
+	// Rules send visitors by platform, language or time to other URLs.
+	Rules []service.TargetRule `json:"rules"`
+	// Variants split traffic by weight; visitors keep theirs via a cookie.
+	Variants []service.Variant `json:"variants"`
+	// UTM is added to the destination on every redirect.
+	UTM *service.UTM `json:"utm"`
+	// QueryPassthrough forwards the query of the short URL.
+	QueryPassthrough bool `json:"query_passthrough"`
+}
+
+// patchBody lists the mutable fields of a link; omitted fields are unchanged.
+type patchBody struct {
+	URL          *string    `json:"url" binding:"omitempty,url"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	TTLSeconds   *int64     `json:"ttl_seconds"`
+	ClearExpiry  bool       `json:"clear_expiry"`
+	MaxClicks    *int       `json:"max_clicks"`
+	RedirectType *int       `json:"redirect_type"`
+	PrivateStats *bool      `json:"private_stats"`
+	Tags         *[]string  `json:"tags"`
+	// Password replaces the link's password; "" removes it.
+	Password     *string `json:"password"`
+	Interstitial *bool   `json:"interstitial"`
+	// Rules replaces the targeting rules; [] removes them.
+	Rules *[]service.TargetRule `json:"rules"`
+	// Variants replaces the variants; [] removes them.
+	Variants *[]service.Variant `json:"variants"`
+	// UTM replaces the UTM template; {} removes it.
+	UTM              *service.UTM `json:"utm"`
+	QueryPassthrough *bool        `json:"query_passthrough"`
 }
 
 var tracer = otel.Tracer("url-shortener/handler")
 
-func HandleShorten(c *gin.Context) {
+// callerFor maps the authenticated principal to a service.Caller. Requests
+// without a principal holding scope act anonymously.
+func callerFor(c *gin.Context, scope string) service.Caller {
+	p := middleware.Principal(c)
+	if !p.Can(scope) {
+		return service.Caller{}
+	}
+	return service.Caller{Owner: p.Owner, Admin: p.Admin}
+}
+
+// URLHandler exposes the Shortener over HTTP.
+type URLHandler struct {
+	svc    *service.Shortener
+	clicks *analytics.Recorder
+}
+
+type HandlerOption func(*URLHandler)
+
+// WithClickRecorder makes every successful redirect emit a click event.
+func WithClickRecorder(rec *analytics.Recorder) HandlerOption {
+	return func(h *URLHandler) { h.clicks = rec }
+}
+
+func NewURLHandler(svc *service.Shortener, opts ...HandlerOption) *URLHandler {
+	h := &URLHandler{svc: svc}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *URLHandler) HandleShorten(c *gin.Context) {
 	ctx, span := tracer.Start(c.Request.Context(), "HandleShorten")
 	defer span.End()
 
@@ -29,7 +115,43 @@ func HandleShorten(c *gin.Context) {
 		return
 	}
 
-	shortURL, err := service.ShortenURL(ctx, body.URL)
+	link, reused, err := h.svc.ShortenURL(ctx, body.URL, service.ShortenOptions{
+		Alias:        body.Alias,
+		ExpiresAt:    body.ExpiresAt,
+		TTL:          time.Duration(body.TTLSeconds) * time.Second,
+		MaxClicks:    body.MaxClicks,
+		RedirectType: body.RedirectType,
+		Owner:        callerFor(c, auth.ScopeLinksWrite).Owner,
+		PrivateStats: body.PrivateStats,
+		Tags:         body.Tags,
+
+		ReuseExisting: body.ReuseExisting,
+		Password:      body.Password,
+		Interstitial:  body.Interstitial,
+		Rules:         body.Rules,
+		Variants:      body.Variants,
+		UTM:           body.UTM,
+
+		QueryPassthrough: body.QueryPassthrough,
+	})
+	if errors.Is(err, service.ErrInvalidAlias) || errors.Is(err, service.ErrInvalidTTL) ||
+		errors.Is(err, service.ErrInvalidLimit) || errors.Is(err, service.ErrInvalidRedirect) ||
+		errors.Is(err, service.ErrInvalidTags) || errors.Is(err, service.ErrInvalidPassword) ||
+		errors.Is(err, service.ErrInvalidRules) || errors.Is(err, service.ErrInvalidVariants) ||
+		errors.Is(err, service.ErrInvalidUTM) {
+		span.SetStatus(codes.Error, "invalid shorten options")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if writePolicyError(c, err) {
+		span.SetStatus(codes.Error, "destination rejected")
+		return
+	}
+	if errors.Is(err, service.ErrAliasTaken) {
+		span.SetStatus(codes.Error, "alias already in use")
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		span.SetStatus(codes.Error, "failed to shorten URL")
 		span.RecordError(err)
@@ -37,41 +159,178 @@ func HandleShorten(c *gin.Context) {
 		return
 	}
 
-	metrics.ShortenCounter.Inc()
-	span.SetAttributes(attribute.String("original_url", body.URL), attribute.String("short_url", shortURL))
-	c.JSON(http.StatusOK, gin.H{"short_url": shortURL})
+	shortURL := h.svc.ShortURL(link.ShortID)
+	span.SetAttributes(attribute.String("original_url", body.URL), attribute.String("short_url", shortURL), attribute.Bool("reused", reused))
+	resp := gin.H{"short_url": shortURL}
+	if link.ExpiresAt != nil {
+		resp["expires_at"] = link.ExpiresAt
+	}
+	if reused {
+		resp["reused"] = true
+	} else {
+		metrics.ShortenCounter.Inc()
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
-func HandleRedirect(c *gin.Context) {
+// writePolicyError answers 422 with the violations when err is a URL policy
+// rejection, and reports whether it did.
+func writePolicyError(c *gin.Context, err error) bool {
+	var perr *urlpolicy.Error
+	if !errors.As(err, &perr) {
+		return false
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": urlpolicy.ErrRejected.Error(), "violations": perr.Violations})
+	return true
+}
+
+func (h *URLHandler) HandleRedirect(c *gin.Context) {
 	ctx, span := tracer.Start(c.Request.Context(), "HandleRedirect")
 	defer span.End()
 
 	shortID := c.Param("shortID")
-	longURL, err := service.ResolveShortID(ctx, shortID)
+	if id, ok := strings.CutSuffix(shortID, "+"); ok {
+		c.Request = c.Request.WithContext(ctx)
+		h.preview(c, span, id)
+		return
+	}
+	res, err := h.svc.ResolveShortID(ctx, shortID, visitFor(c))
+	if errors.Is(err, service.ErrPasswordRequired) {
+		span.SetStatus(codes.Error, "password required")
+		renderPage(c, http.StatusOK, "password.html", gin.H{})
+		return
+	}
 	if err != nil {
+		writeResolveError(c, span, err)
+		return
+	}
+	if res.Interstitial {
+		span.SetAttributes(attribute.String("short_id", shortID), attribute.Bool("interstitial", true))
+		// Show where this visitor will be sent, and keep their variant for
+		// when they continue.
+		page := h.newPreviewPage(res.Link, service.Caller{}, true)
+		page.LongURL, page.Domain = res.LongURL, repository.DestinationDomain(res.LongURL)
+		if q := c.Request.URL.RawQuery; q != "" && res.Link.QueryPassthrough {
+			page.Action += "?" + q
+		}
+		setVariantCookie(c, shortID, res.Variant)
+		renderPage(c, http.StatusOK, "preview.html", page)
+		return
+	}
+
+	metrics.RedirectCounter.Inc()
+	h.recordClick(c, shortID, res.Country)
+	setVariantCookie(c, shortID, res.Variant)
+	span.SetAttributes(attribute.String("short_id", shortID), attribute.String("redirect_url", res.LongURL))
+	c.Header("Cache-Control", cacheControl(res, time.Now()))
+	c.Redirect(res.StatusCode, res.LongURL)
+}
+
+// writeResolveError answers a request for a short ID that cannot be followed.
+func writeResolveError(c *gin.Context, span trace.Span, err error) {
+	span.RecordError(err)
+	var blocked *service.BlockedError
+	switch {
+	case errors.As(err, &blocked):
+		span.SetStatus(codes.Error, "destination domain is blocked")
+		renderPage(c, http.StatusForbidden, "blocked.html", gin.H{
+			"Domain":  blocked.Rule.Domain,
+			"Reason":  blocked.Rule.Reason,
+			"LongURL": blocked.LongURL,
+		})
+	case errors.Is(err, service.ErrExpired), errors.Is(err, service.ErrClickLimit):
+		span.SetStatus(codes.Error, "short ID no longer available")
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	default:
 		span.SetStatus(codes.Error, "short ID not found")
-		span.RecordError(err)
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	}
+}
+
+// visitFor describes the request for targeting rules and variants. Its IP
+// keys the password attempt limit, so it relies on c.ClientIP() ignoring
+// forwarding headers that do not come from a trusted proxy.
+func visitFor(c *gin.Context) service.Visit {
+	variant, _ := c.Cookie(variantCookie(c.Param("shortID")))
+	return service.Visit{
+		IP:             c.ClientIP(),
+		UserAgent:      c.Request.UserAgent(),
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+		Variant:        variant,
+		Query:          c.Request.URL.RawQuery,
+		Time:           time.Now(),
+	}
+}
+
+// variantCookieMaxAge is how long a visitor keeps the variant of a link.
+const variantCookieMaxAge = 30 * 24 * time.Hour
+
+func variantCookie(shortID string) string {
+	return "v_" + shortID
+}
+
+// setVariantCookie remembers the variant a visitor was sent to, scoped to the
+// short link's own path.
+func setVariantCookie(c *gin.Context, shortID, variant string) {
+	if variant == "" {
 		return
 	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(variantCookie(shortID), variant, int(variantCookieMaxAge.Seconds()),
+		c.Request.URL.Path, "", c.Request.TLS != nil, true)
+}
 
-	metrics.RedirectCounter.Inc()
-	span.SetAttributes(attribute.String("short_id", shortID), attribute.String("redirect_url", longURL))
-	//c.JSON(http.StatusOK, gin.H{"target": longURL})
-	c.Redirect(http.StatusMovedPermanently, longURL)
+func (h *URLHandler) recordClick(c *gin.Context, shortID, country string) {
+	if h.clicks == nil {
+		return
+	}
+	h.clicks.Record(analytics.ClickEvent{
+		ShortID:        shortID,
+		Timestamp:      time.Now().UTC(),
+		Referrer:       c.Request.Referer(),
+		UserAgent:      c.Request.UserAgent(),
+		IPHash:         h.clicks.HashIP(c.ClientIP()),
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+		Country:        country,
+	})
+}
+
+// permanentRedirectMaxAge bounds how long browsers may cache a 301/308.
+const permanentRedirectMaxAge = 24 * time.Hour
+
+// cacheControl lets browsers cache permanent redirects, but never past the
+// link's expiry. Temporary and click-limited redirects, and those whose
+// destination depends on the visitor or on the owner's UTM template, which
+// can change at any time, stay uncached so every visit reaches the server.
+func cacheControl(res *service.Resolution, now time.Time) string {
+	permanent := res.StatusCode == http.StatusMovedPermanently || res.StatusCode == http.StatusPermanentRedirect
+	if !permanent || res.Link.MaxClicks > 0 || !res.Link.Direct() || res.OwnerUTM {
+		return "private, no-cache, no-store, must-revalidate"
+	}
+	maxAge := permanentRedirectMaxAge
+	if res.Link.ExpiresAt != nil {
+		if remaining := res.Link.ExpiresAt.Sub(now); remaining < maxAge {
+			maxAge = remaining
+		}
+	}
+	return fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
 }
 
-func HandleDelete(c *gin.Context) {
+func (h *URLHandler) HandleDelete(c *gin.Context) {
 	ctx, span := tracer.Start(c.Request.Context(), "HandleDelete")
 	defer span.End()
 
 	shortID := c.Param("shortID")
 
-	err := service.DeleteShortID(ctx, shortID)
+	err := h.svc.DeleteShortID(ctx, shortID, callerFor(c, auth.ScopeLinksDelete))
 	if err != nil {
 		span.SetStatus(codes.Error, "failed to delete short ID")
 		span.RecordError(err)
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		status := http.StatusNotFound
+		if errors.Is(err, service.ErrForbidden) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -79,16 +338,84 @@ func HandleDelete(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "short URL deleted successfully"})
 }
 
-func HandleStats(c *gin.Context) {
+func (h *URLHandler) HandleUpdate(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandleUpdate")
+	defer span.End()
+
+	shortID := c.Param("shortID")
+	var body patchBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		span.SetStatus(codes.Error, "invalid request body")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	upd := service.LinkUpdate{
+		LongURL:      body.URL,
+		ExpiresAt:    body.ExpiresAt,
+		ClearExpiry:  body.ClearExpiry,
+		MaxClicks:    body.MaxClicks,
+		RedirectType: body.RedirectType,
+		StatsPrivate: body.PrivateStats,
+		Tags:         body.Tags,
+		Password:     body.Password,
+		Interstitial: body.Interstitial,
+		Rules:        body.Rules,
+		Variants:     body.Variants,
+		UTM:          body.UTM,
+
+		QueryPassthrough: body.QueryPassthrough,
+	}
+	if body.TTLSeconds != nil {
+		ttl := time.Duration(*body.TTLSeconds) * time.Second
+		upd.TTL = &ttl
+	}
+
+	link, err := h.svc.UpdateLink(ctx, shortID, upd, callerFor(c, auth.ScopeLinksWrite))
+	if writePolicyError(c, err) {
+		span.SetStatus(codes.Error, "destination rejected")
+		return
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to update short ID")
+		span.RecordError(err)
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, service.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, service.ErrEmptyUpdate), errors.Is(err, service.ErrInvalidTTL),
+			errors.Is(err, service.ErrInvalidLimit), errors.Is(err, service.ErrInvalidRedirect),
+			errors.Is(err, service.ErrInvalidTags), errors.Is(err, service.ErrInvalidPassword),
+			errors.Is(err, service.ErrInvalidRules), errors.Is(err, service.ErrInvalidVariants),
+			errors.Is(err, service.ErrInvalidUTM):
+			status = http.StatusBadRequest
+		case errors.Is(err, service.ErrConflict):
+			status = http.StatusConflict
+		case errors.Is(err, service.ErrForbidden):
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	span.SetAttributes(attribute.String("short_id", shortID), attribute.String("redirect_url", link.LongURL))
+	c.JSON(http.StatusOK, link)
+}
+
+func (h *URLHandler) HandleStats(c *gin.Context) {
 	ctx, span := tracer.Start(c.Request.Context(), "HandleStats")
 	defer span.End()
 
 	shortID := c.Param("shortID")
-	stats, err := service.GetURLStats(ctx, shortID)
+	stats, err := h.svc.GetURLStats(ctx, shortID, callerFor(c, auth.ScopeStatsRead))
 	if err != nil {
 		span.SetStatus(codes.Error, "failed to get stats")
 		span.RecordError(err)
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		status := http.StatusNotFound
+		if errors.Is(err, service.ErrForbidden) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -96,6 +423,71 @@ func HandleStats(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
+// HandleList serves GET /links. Query parameters: owner, created_from and
+// created_to (RFC 3339), tag, domain, sort (created_at|access_count), order
+// (asc|desc), limit and cursor.
+func (h *URLHandler) HandleList(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandleList")
+	defer span.End()
+
+	q := service.LinkQuery{
+		Filter: repository.LinkFilter{
+			Owner:  c.Query("owner"),
+			Tag:    c.Query("tag"),
+			Domain: c.Query("domain"),
+		},
+		Sort:   c.Query("sort"),
+		Cursor: c.Query("cursor"),
+	}
+	var badParam string
+	for name, dst := range map[string]**time.Time{"created_from": &q.Filter.CreatedFrom, "created_to": &q.Filter.CreatedTo} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				badParam = name + " must be an RFC 3339 timestamp"
+			}
+			*dst = &t
+		}
+	}
+	switch c.Query("order") {
+	case "", "desc":
+	case "asc":
+		q.Asc = true
+	default:
+		badParam = "order must be asc or desc"
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			badParam = "limit must be a positive integer"
+		}
+		q.Limit = limit
+	}
+	if badParam != "" {
+		span.SetStatus(codes.Error, "invalid query")
+		c.JSON(http.StatusBadRequest, gin.H{"error": badParam})
+		return
+	}
+
+	page, err := h.svc.ListLinks(ctx, q, callerFor(c, auth.ScopeStatsRead))
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to list links")
+		span.RecordError(err)
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, service.ErrInvalidCursor), errors.Is(err, service.ErrInvalidQuery):
+			status = http.StatusBadRequest
+		case errors.Is(err, service.ErrForbidden):
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	span.SetAttributes(attribute.Int("results", len(page.Links)), attribute.Int64("total", page.Total))
+	c.JSON(http.StatusOK, page)
+}
+
 func HandleMetrics(c *gin.Context) {
 	promhttp.Handler().ServeHTTP(c.Writer, c.Request)
 }
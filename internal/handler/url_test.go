@@ -11,19 +11,57 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/auth"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
 	"github.com/joaopaulo-bertoncini/url-shortener/internal/middleware"
 	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
 	"github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/urlpolicy"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
+func TestMain(m *testing.M) {
+	_ = logger.InitLogger()
+	os.Exit(m.Run())
+}
+
+// testKeys accepts "testtoken123" as the bootstrap admin token.
+func testKeys() *auth.KeyManager {
+	return auth.NewKeyManager(repository.NewMemoryKeyStore(), "testtoken123")
+}
+
+func newTestHandler() (*URLHandler, *repository.MockLinkStore, *repository.MockCache) {
+	store := new(repository.MockLinkStore)
+	cache := new(repository.MockCache)
+	svc := service.NewShortener(store, cache, service.WithURLPrefix("http://localhost:8080/"))
+	return NewURLHandler(svc), store, cache
+}
+
+// cachedURL matches the JSON cache entry of a link pointing at longURL.
+func cachedURL(longURL string) interface{} {
+	return mock.MatchedBy(func(v string) bool {
+		var m repository.URLMapping
+		return json.Unmarshal([]byte(v), &m) == nil && m.LongURL == longURL
+	})
+}
+
+func cacheEntry(m repository.URLMapping) string {
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
 func TestShortenHandler_Success(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	os.Setenv("AUTH_TOKEN", "testtoken123")
+
+	h, store, cache := newTestHandler()
+	cache.On("Set", mock.Anything, mock.Anything, cachedURL("https://example.com"), mock.Anything).Return(nil)
+	store.On("Create", mock.Anything, mock.AnythingOfType("*repository.URLMapping")).Return(nil)
 
 	r := gin.New()
-	r.Use(middleware.AuthMiddleware())
-	r.POST("/shorten", HandleShorten)
+	r.Use(middleware.AuthMiddleware(testKeys()))
+	r.POST("/shorten", h.HandleShorten)
 
 	body := map[string]string{"url": "https://example.com"}
 	jsonBody, _ := json.Marshal(body)
@@ -41,36 +79,207 @@ func TestShortenHandler_Success(t *testing.T) {
 	err := json.Unmarshal(resp.Body.Bytes(), &response)
 	assert.NoError(t, err)
 	assert.Contains(t, response["short_url"], "http://localhost:8080/")
+	store.AssertExpectations(t)
+}
+
+func TestShortenHandler_RetriesOnCollision(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h, store, cache := newTestHandler()
+	store.On("Create", mock.Anything, mock.Anything).Return(repository.ErrDuplicate).Twice()
+	store.On("Create", mock.Anything, mock.Anything).Return(nil).Once()
+	cache.On("Set", mock.Anything, mock.Anything, cachedURL("https://example.com"), mock.Anything).Return(nil)
+
+	r := gin.New()
+	r.Use(middleware.AuthMiddleware(testKeys()))
+	r.POST("/shorten", h.HandleShorten)
+
+	jsonBody, _ := json.Marshal(map[string]string{"url": "https://example.com"})
+	req, _ := http.NewRequest(http.MethodPost, "/shorten", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer testtoken123")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	store.AssertNumberOfCalls(t, "Create", 3)
+}
+
+func TestShortenHandler_Alias(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h, store, cache := newTestHandler()
+	store.On("Create", mock.Anything, mock.MatchedBy(func(m *repository.URLMapping) bool { return m.ShortID == "spring-sale" })).
+		Return(nil).Once()
+	store.On("Create", mock.Anything, mock.MatchedBy(func(m *repository.URLMapping) bool { return m.ShortID == "spring-sale" })).
+		Return(repository.ErrDuplicate)
+	cache.On("Set", mock.Anything, "spring-sale", cachedURL("https://example.com"), mock.Anything).Return(nil).Once()
+
+	r := gin.New()
+	r.Use(middleware.AuthMiddleware(testKeys()))
+	r.POST("/shorten", h.HandleShorten)
+
+	shorten := func(alias string) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(map[string]string{"url": "https://example.com", "alias": alias})
+		req, _ := http.NewRequest(http.MethodPost, "/shorten", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer testtoken123")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := shorten("spring-sale")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "http://localhost:8080/spring-sale")
+
+	assert.Equal(t, http.StatusConflict, shorten("spring-sale").Code)
+	assert.Equal(t, http.StatusBadRequest, shorten("stats").Code)
+	assert.Equal(t, http.StatusBadRequest, shorten("no spaces").Code)
+	assert.Equal(t, http.StatusBadRequest, shorten("ab").Code)
+	cache.AssertExpectations(t)
 }
 
 func TestRedirectHandler_Success(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
+	h, store, cache := newTestHandler()
+
 	r := gin.New()
-	r.GET("/:id", HandleRedirect)
+	r.GET("/:shortID", h.HandleRedirect)
 
-	// Pré-popula o Redis com shortID
+	// Pré-popula o cache com shortID
 	shortID := "abc12345"
 	longURL := "https://example.com"
-	_ = repository.RedisClient.Set(context.Background(), shortID, longURL, time.Hour).Err()
+	cache.On("Get", mock.Anything, shortID).Return(cacheEntry(repository.URLMapping{ShortID: shortID, LongURL: longURL}), nil)
+	store.On("IncrementAccessCount", mock.Anything, shortID).Return(&repository.URLMapping{ShortID: shortID, LongURL: longURL}, nil)
 
 	req, _ := http.NewRequest(http.MethodGet, "/"+shortID, nil)
 	resp := httptest.NewRecorder()
 	r.ServeHTTP(resp, req)
 
-	assert.Equal(t, http.StatusFound, resp.Code)
+	assert.Equal(t, http.StatusMovedPermanently, resp.Code)
 	assert.Equal(t, longURL, resp.Header().Get("Location"))
+	assert.Equal(t, "public, max-age=86400", resp.Header().Get("Cache-Control"))
+	store.AssertCalled(t, "IncrementAccessCount", mock.Anything, shortID)
+}
+
+func TestRedirectHandler_RedirectType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h, store, cache := newTestHandler()
+
+	r := gin.New()
+	r.GET("/:shortID", h.HandleRedirect)
+
+	cache.On("Get", mock.Anything, "tracked1").
+		Return(cacheEntry(repository.URLMapping{ShortID: "tracked1", LongURL: "https://example.com", RedirectType: http.StatusFound}), nil)
+	store.On("IncrementAccessCount", mock.Anything, "tracked1").Return(&repository.URLMapping{}, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "/tracked1", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusFound, resp.Code)
+	assert.Contains(t, resp.Header().Get("Cache-Control"), "no-store")
+}
+
+func TestRedirectHandler_Expired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h, store, cache := newTestHandler()
+
+	r := gin.New()
+	r.GET("/:shortID", h.HandleRedirect)
+
+	expiredAt := time.Now().Add(-time.Minute)
+	cache.On("Get", mock.Anything, "expired1").Return("", repository.ErrCacheMiss)
+	store.On("Get", mock.Anything, "expired1").
+		Return(&repository.URLMapping{ShortID: "expired1", LongURL: "https://example.com", ExpiresAt: &expiredAt}, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "/expired1", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusGone, resp.Code)
+	store.AssertNotCalled(t, "IncrementAccessCount", mock.Anything, mock.Anything)
+	cache.AssertNotCalled(t, "Set", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRedirectHandler_ClickLimitReached(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h, store, cache := newTestHandler()
+
+	r := gin.New()
+	r.GET("/:shortID", h.HandleRedirect)
+
+	cache.On("Get", mock.Anything, "invite01").
+		Return(cacheEntry(repository.URLMapping{ShortID: "invite01", LongURL: "https://example.com", MaxClicks: 1}), nil)
+	store.On("IncrementAccessCount", mock.Anything, "invite01").Return(nil, repository.ErrExhausted)
+
+	req, _ := http.NewRequest(http.MethodGet, "/invite01", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusGone, resp.Code)
+	assert.Empty(t, resp.Header().Get("Location"))
+}
+
+func TestUpdateHandler_RepointsDestination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := repository.NewMemoryLinkStore()
+	cache := repository.NewMemoryCache()
+	h := NewURLHandler(service.NewShortener(store, cache))
+	require.NoError(t, store.Create(context.Background(), &repository.URLMapping{ShortID: "poster01", LongURL: "https://example.com/old", Created: time.Now()}))
+
+	r := gin.New()
+	r.GET("/:shortID", h.HandleRedirect)
+	r.Use(middleware.AuthMiddleware(testKeys()))
+	r.PATCH("/short/:shortID", h.HandleUpdate)
+
+	// Warm the cache with the old destination.
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/poster01", nil))
+	assert.Equal(t, "https://example.com/old", resp.Header().Get("Location"))
+
+	req := httptest.NewRequest(http.MethodPatch, "/short/poster01", bytes.NewBufferString(`{"url": "https://example.com/new", "max_clicks": 10}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer testtoken123")
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	var updated service.URLMapping
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &updated))
+	assert.Equal(t, "https://example.com/new", updated.LongURL)
+	assert.Equal(t, 10, updated.MaxClicks)
+	require.Len(t, updated.History, 1)
+	assert.Equal(t, "https://example.com/old", updated.History[0].LongURL)
+
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/poster01", nil))
+	assert.Equal(t, "https://example.com/new", resp.Header().Get("Location"))
+
+	req = httptest.NewRequest(http.MethodPatch, "/short/missing1", bytes.NewBufferString(`{"url": "https://example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer testtoken123")
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
 }
 
 func TestStatsHandler_Success(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	os.Setenv("AUTH_TOKEN", "testtoken123")
+
+	h, store, _ := newTestHandler()
 
 	r := gin.New()
-	r.Use(middleware.AuthMiddleware())
-	r.GET("/stats/:id", HandleStats)
+	r.Use(middleware.AuthMiddleware(testKeys()))
+	r.GET("/stats/:shortID", h.HandleStats)
 
-	// Insere no Mongo direto
+	// Registro já existente no store
 	shortID := "abc12345"
 	doc := service.URLMapping{
 		ShortID:     shortID,
@@ -78,11 +287,10 @@ func TestStatsHandler_Success(t *testing.T) {
 		Created:     time.Now(),
 		AccessCount: 42,
 	}
-	collection := repository.MongoClient.Database("shortener").Collection("urls")
-	_, _ = collection.InsertOne(context.Background(), doc)
+	store.On("Get", mock.Anything, shortID).Return(&doc, nil)
 
 	req, _ := http.NewRequest(http.MethodGet, "/stats/"+shortID, nil)
-	req.Header.Set("Authorization", "Bearer supersecrettoken")
+	req.Header.Set("Authorization", "Bearer testtoken123")
 	resp := httptest.NewRecorder()
 	r.ServeHTTP(resp, req)
 
@@ -95,3 +303,181 @@ func TestStatsHandler_Success(t *testing.T) {
 	assert.Equal(t, doc.LongURL, response.LongURL)
 	assert.Equal(t, doc.AccessCount, response.AccessCount)
 }
+
+func TestOwnership_LimitsManagementAndPrivateStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	keys := testKeys()
+	owner, _, err := keys.Create(ctx, auth.KeySpec{Owner: "team-a", Scopes: auth.Scopes})
+	require.NoError(t, err)
+	other, _, err := keys.Create(ctx, auth.KeySpec{Owner: "team-b", Scopes: auth.Scopes})
+	require.NoError(t, err)
+
+	h := NewURLHandler(service.NewShortener(repository.NewMemoryLinkStore(), repository.NewMemoryCache()))
+	r := gin.New()
+	r.GET("/stats/:shortID", middleware.OptionalAuthMiddleware(keys), h.HandleStats)
+	protected := r.Group("/", middleware.AuthMiddleware(keys))
+	protected.POST("/shorten", h.HandleShorten)
+	protected.PATCH("/short/:shortID", h.HandleUpdate)
+	protected.DELETE("/short/:shortID", h.HandleDelete)
+
+	send := func(method, path, token, body string) int {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	require.Equal(t, http.StatusOK, send(http.MethodPost, "/shorten", owner, `{"url": "https://example.com", "alias": "team-a-link", "private_stats": true}`))
+
+	assert.Equal(t, http.StatusForbidden, send(http.MethodGet, "/stats/team-a-link", "", ""))
+	assert.Equal(t, http.StatusForbidden, send(http.MethodGet, "/stats/team-a-link", other, ""))
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/stats/team-a-link", owner, ""))
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/stats/team-a-link", "testtoken123", ""))
+
+	assert.Equal(t, http.StatusForbidden, send(http.MethodPatch, "/short/team-a-link", other, `{"url": "https://evil.example"}`))
+	assert.Equal(t, http.StatusForbidden, send(http.MethodDelete, "/short/team-a-link", other, ""))
+
+	assert.Equal(t, http.StatusOK, send(http.MethodPatch, "/short/team-a-link", owner, `{"private_stats": false}`))
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/stats/team-a-link", "", ""))
+	assert.Equal(t, http.StatusOK, send(http.MethodDelete, "/short/team-a-link", owner, ""))
+}
+
+func TestListHandler_PaginatesOwnLinks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	keys := testKeys()
+	owner, _, err := keys.Create(ctx, auth.KeySpec{Owner: "team-a", Scopes: auth.Scopes})
+	require.NoError(t, err)
+
+	store := repository.NewMemoryLinkStore()
+	base := time.Now().Add(-time.Hour)
+	for i, id := range []string{"link-1", "link-2", "link-3"} {
+		require.NoError(t, store.Create(ctx, &repository.URLMapping{ShortID: id, LongURL: "https://example.com", Owner: "team-a", Created: base.Add(time.Duration(i) * time.Minute)}))
+	}
+	require.NoError(t, store.Create(ctx, &repository.URLMapping{ShortID: "foreign", LongURL: "https://example.com", Owner: "team-b", Created: base}))
+
+	h := NewURLHandler(service.NewShortener(store, repository.NewMemoryCache()))
+	r := gin.New()
+	r.GET("/:shortID", h.HandleRedirect)
+	r.GET("/links", middleware.AuthMiddleware(keys), h.HandleList)
+
+	list := func(query string) service.LinkPage {
+		req := httptest.NewRequest(http.MethodGet, "/links?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+owner)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var page service.LinkPage
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &page))
+		return page
+	}
+
+	page := list("limit=2&owner=team-b")
+	assert.Equal(t, int64(3), page.Total)
+	require.Len(t, page.Links, 2)
+	assert.Equal(t, "link-3", page.Links[0].ShortID)
+	require.NotEmpty(t, page.NextCursor)
+
+	page = list("limit=2&cursor=" + page.NextCursor)
+	require.Len(t, page.Links, 1)
+	assert.Equal(t, "link-1", page.Links[0].ShortID)
+	assert.Empty(t, page.NextCursor)
+
+	req := httptest.NewRequest(http.MethodGet, "/links?sort=access_count&cursor=bogus", nil)
+	req.Header.Set("Authorization", "Bearer "+owner)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestShortenHandler_ReusesNormalizedDestination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	keys := testKeys()
+	owner, _, err := keys.Create(ctx, auth.KeySpec{Owner: "team-a", Scopes: auth.Scopes})
+	require.NoError(t, err)
+	other, _, err := keys.Create(ctx, auth.KeySpec{Owner: "team-b", Scopes: auth.Scopes})
+	require.NoError(t, err)
+
+	h := NewURLHandler(service.NewShortener(repository.NewMemoryLinkStore(), repository.NewMemoryCache()))
+	r := gin.New()
+	r.POST("/shorten", middleware.AuthMiddleware(keys), h.HandleShorten)
+
+	shorten := func(token, body string) map[string]any {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var out map[string]any
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &out))
+		return out
+	}
+
+	first := shorten(owner, `{"url": "https://example.com/p?b=2&a=1"}`)
+	assert.Nil(t, first["reused"])
+
+	again := shorten(owner, `{"url": "HTTPS://Example.com:443/p?a=1&utm_source=news&b=2", "reuse_existing": true}`)
+	assert.Equal(t, first["short_url"], again["short_url"])
+	assert.Equal(t, true, again["reused"])
+
+	fresh := shorten(owner, `{"url": "https://example.com/p?b=2&a=1"}`)
+	assert.NotEqual(t, first["short_url"], fresh["short_url"])
+
+	// A newer link with options is skipped, not the end of the search.
+	tracked := shorten(owner, `{"url": "https://example.com/p?a=1&b=2", "query_passthrough": true}`)
+	assert.NotEqual(t, fresh["short_url"], tracked["short_url"])
+	again = shorten(owner, `{"url": "https://example.com/p?a=1&b=2", "reuse_existing": true}`)
+	assert.Equal(t, fresh["short_url"], again["short_url"])
+
+	// A request with options gets a link of its own, and the links it
+	// creates are not handed out for plain requests either.
+	for _, opts := range []string{`"max_clicks": 1`, `"ttl_seconds": 3600`, `"interstitial": true`, `"redirect_type": 302`, `"private_stats": true`} {
+		special := shorten(owner, `{"url": "https://example.com/p?a=1&b=2", "reuse_existing": true, `+opts+`}`)
+		assert.NotEqual(t, fresh["short_url"], special["short_url"], opts)
+		assert.Nil(t, special["reused"], opts)
+	}
+	again = shorten(owner, `{"url": "https://example.com/p?a=1&b=2", "reuse_existing": true}`)
+	assert.Equal(t, fresh["short_url"], again["short_url"])
+
+	foreign := shorten(other, `{"url": "https://example.com/p?b=2&a=1", "reuse_existing": true}`)
+	assert.NotEqual(t, first["short_url"], foreign["short_url"])
+	assert.Nil(t, foreign["reused"])
+}
+
+func TestShortenHandler_RejectsUnsafeDestinations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewURLHandler(service.NewShortener(repository.NewMemoryLinkStore(), repository.NewMemoryCache(), service.WithURLPrefix("https://sho.rt/")))
+	r := gin.New()
+	r.POST("/shorten", h.HandleShorten)
+
+	cases := map[string]string{
+		"javascript:alert(document.cookie)":  "scheme_not_allowed",
+		"http://169.254.169.254/latest/meta": "private_host",
+		"https://sho.rt/abc12345":            "self_reference",
+		"https://аррӏе.com/login":            "homograph_domain",
+	}
+	for url, code := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", bytes.NewBufferString(`{"url": "`+url+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusUnprocessableEntity, resp.Code, url)
+
+		var body struct {
+			Violations []urlpolicy.Violation `json:"violations"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+		require.Len(t, body.Violations, 1, url)
+		assert.Equal(t, code, body.Violations[0].Code, url)
+	}
+}
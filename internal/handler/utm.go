@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/middleware"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/utm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// UTMHandler exposes the UTM template of the caller's owner. Admins can
+// manage the template of any owner with ?owner=.
+type UTMHandler struct {
+	store     repository.UTMStore
+	templates *utm.Templates
+}
+
+func NewUTMHandler(store repository.UTMStore, templates *utm.Templates) *UTMHandler {
+	return &UTMHandler{store: store, templates: templates}
+}
+
+// owner returns the owner whose template the request acts on, or "" when the
+// caller has none.
+func (h *UTMHandler) owner(c *gin.Context) string {
+	p := middleware.Principal(c)
+	if p == nil {
+		return ""
+	}
+	if owner := c.Query("owner"); owner != "" && p.Admin {
+		return owner
+	}
+	return p.Owner
+}
+
+func (h *UTMHandler) HandleGet(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandleGetUTM")
+	defer span.End()
+
+	owner := h.owner(c)
+	t, err := h.store.GetOwnerUTM(ctx, owner)
+	if errors.Is(err, repository.ErrNotFound) {
+		span.SetStatus(codes.Error, "UTM template not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": "UTM template not found"})
+		return
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to load UTM template")
+		span.RecordError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+func (h *UTMHandler) HandlePut(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandlePutUTM")
+	defer span.End()
+
+	owner := h.owner(c)
+	if owner == "" {
+		span.SetStatus(codes.Error, "caller has no owner")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "owner is required"})
+		return
+	}
+	var body repository.UTM
+	if err := c.ShouldBindJSON(&body); err != nil {
+		span.SetStatus(codes.Error, "invalid request body")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	checked, err := utm.Check(body)
+	if err != nil {
+		span.SetStatus(codes.Error, "invalid UTM template")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if checked == (repository.UTM{}) {
+		span.SetStatus(codes.Error, "empty UTM template")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one UTM parameter is required"})
+		return
+	}
+
+	t := repository.OwnerUTM{Owner: owner, UTM: checked, UpdatedAt: time.Now().UTC()}
+	if err := h.store.PutOwnerUTM(ctx, &t); err != nil {
+		span.SetStatus(codes.Error, "failed to save UTM template")
+		span.RecordError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.reload(c)
+
+	span.SetAttributes(attribute.String("owner", owner))
+	c.JSON(http.StatusOK, t)
+}
+
+func (h *UTMHandler) HandleDelete(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "HandleDeleteUTM")
+	defer span.End()
+
+	owner := h.owner(c)
+	err := h.store.DeleteOwnerUTM(ctx, owner)
+	if errors.Is(err, repository.ErrNotFound) {
+		span.SetStatus(codes.Error, "UTM template not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": "UTM template not found"})
+		return
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to delete UTM template")
+		span.RecordError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.reload(c)
+
+	span.SetAttributes(attribute.String("owner", owner))
+	c.JSON(http.StatusOK, gin.H{"message": "UTM template deleted successfully"})
+}
+
+// reload refreshes the in-memory templates so the next redirect served here
+// uses the new one; a failure only delays it until Templates.Run reloads.
+func (h *UTMHandler) reload(c *gin.Context) {
+	if err := h.templates.Reload(c.Request.Context()); err != nil {
+		logger.Log.Warnf("UTM template reload error: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/middleware"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/utm"
+)
+
+func TestUTM_TemplatesAndPassthrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := repository.NewMemoryUTMStore()
+	templates := utm.NewTemplates(store)
+	h := NewURLHandler(service.NewShortener(repository.NewMemoryLinkStore(), repository.NewMemoryCache(), service.WithOwnerUTM(templates)))
+	owners := NewUTMHandler(store, templates)
+
+	r := gin.New()
+	r.GET("/:shortID", h.HandleRedirect)
+	protected := r.Group("/", middleware.AuthMiddleware(testKeys()))
+	protected.POST("/shorten", h.HandleShorten)
+	protected.PATCH("/short/:shortID", h.HandleUpdate)
+	protected.GET("/utm", owners.HandleGet)
+	protected.PUT("/utm", owners.HandlePut)
+	protected.DELETE("/utm", owners.HandleDelete)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer testtoken123")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+	redirect := func(path string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, path, nil))
+		return resp
+	}
+	location := func(path string) string {
+		return redirect(path).Header().Get("Location")
+	}
+	const noStore = "private, no-cache, no-store, must-revalidate"
+
+	resp := send(http.MethodPut, "/utm", `{"source": "acme", "medium": "email"}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	resp = send(http.MethodGet, "/utm", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"source":"acme"`)
+
+	resp = send(http.MethodPost, "/shorten", `{"url": "https://example.com/p?utm_medium=social&q=a%20b", "alias": "spring",
+		"utm": {"campaign": "spring sale", "content": "{short_id}"}, "query_passthrough": true}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	// Forwarded query > destination > link template > owner template.
+	assert.Equal(t, "https://example.com/p?utm_medium=social&q=a%20b&utm_source=partner&utm_campaign=spring+sale&utm_content=spring",
+		location("/spring?utm_source=partner"))
+	assert.Equal(t, "https://example.com/p?q=a%20b&utm_medium=cpc&utm_campaign=spring+sale&utm_content=spring&utm_source=acme",
+		location("/spring?utm_medium=cpc"))
+	assert.Equal(t, noStore, redirect("/spring").Header().Get("Cache-Control"))
+
+	resp = send(http.MethodPatch, "/short/spring", `{"utm": {}, "query_passthrough": false}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Equal(t, "https://example.com/p?utm_medium=social&q=a%20b&utm_source=acme", location("/spring?ref=x"))
+	// The owner template may change at any time.
+	assert.Equal(t, noStore, redirect("/spring").Header().Get("Cache-Control"))
+
+	require.Equal(t, http.StatusOK, send(http.MethodDelete, "/utm", "").Code)
+	resp = redirect("/spring")
+	assert.Equal(t, "https://example.com/p?utm_medium=social&q=a%20b", resp.Header().Get("Location"))
+	assert.Equal(t, "public, max-age=86400", resp.Header().Get("Cache-Control"))
+	for alias, opts := range map[string]string{"tagged": `"utm": {"source": "qr"}`, "forward": `"query_passthrough": true`} {
+		resp = send(http.MethodPost, "/shorten", `{"url": "https://example.com/p", "alias": "`+alias+`", `+opts+`}`)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		assert.Equal(t, noStore, redirect("/"+alias).Header().Get("Cache-Control"), alias)
+	}
+	assert.Equal(t, http.StatusNotFound, send(http.MethodGet, "/utm", "").Code)
+
+	long := strings.Repeat("x", 201)
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodPut, "/utm", `{"campaign": "`+long+`"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodPut, "/utm", `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/shorten", `{"url": "https://example.com/", "utm": {"term": "`+long+`"}}`).Code)
+}
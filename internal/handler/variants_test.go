@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/service"
+)
+
+func TestVariants(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc := service.NewShortener(repository.NewMemoryLinkStore(), repository.NewMemoryCache())
+	h := NewURLHandler(svc)
+	r := gin.New()
+	r.POST("/shorten", h.HandleShorten)
+	r.GET("/stats/:shortID", h.HandleStats)
+	r.GET("/:shortID", h.HandleRedirect)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+	visit := func(cookie string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/landing", nil)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "v_landing", Value: cookie})
+		}
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := post(`{"url": "https://example.com/landing", "alias": "landing", "variants": [
+		{"long_url": "https://example.com/landing-a"},
+		{"id": "B", "long_url": "https://example.com/landing-b", "weight": 3}
+	]}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	want := map[string]string{"a": "https://example.com/landing-a", "b": "https://example.com/landing-b"}
+	seen := map[string]int{}
+	for i := 0; i < 60; i++ {
+		resp := visit("")
+		require.Equal(t, http.StatusMovedPermanently, resp.Code)
+		cookies := resp.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, "v_landing", cookies[0].Name)
+		assert.Equal(t, "/landing", cookies[0].Path)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.Equal(t, want[cookies[0].Value], resp.Header().Get("Location"))
+		assert.Equal(t, "private, no-cache, no-store, must-revalidate", resp.Header().Get("Cache-Control"))
+		seen[cookies[0].Value]++
+	}
+	assert.Len(t, seen, 2, "both variants should be drawn")
+
+	// Returning visitors keep their variant; unknown ones are drawn again.
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, want["a"], visit("a").Header().Get("Location"))
+	}
+	assert.Contains(t, want, visit("gone").Result().Cookies()[0].Value)
+
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/stats/landing", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var stats repository.URLMapping
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &stats))
+	assert.Equal(t, 71, stats.AccessCount)
+	assert.Equal(t, 71, stats.VariantClicks["a"]+stats.VariantClicks["b"])
+	assert.GreaterOrEqual(t, stats.VariantClicks["a"], seen["a"]+10)
+	require.Len(t, stats.Variants, 2)
+	assert.Equal(t, 1, stats.Variants[0].Weight)
+
+	for _, body := range []string{
+		`{"url": "https://example.com/", "variants": [{"long_url": "https://example.com/a"}]}`,
+		`{"url": "https://example.com/", "variants": [{"id": "x", "long_url": "https://example.com/a"}, {"id": "x", "long_url": "https://example.com/b"}]}`,
+		`{"url": "https://example.com/", "variants": [{"id": "a.b", "long_url": "https://example.com/a"}, {"long_url": "https://example.com/b"}]}`,
+		`{"url": "https://example.com/", "variants": [{"long_url": "https://example.com/a", "weight": -1}, {"long_url": "https://example.com/b"}]}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, post(body).Code, body)
+	}
+}
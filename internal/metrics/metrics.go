@@ -72,6 +72,15 @@ var (
 		[]string{"operation"},
 	)
 
+	PostgresOpDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "postgres_operation_duration_seconds",
+			Help:    "Duration of PostgreSQL operations",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"operation"},
+	)
+
 	RedisOpDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "redis_operation_duration_seconds",
@@ -81,6 +90,98 @@ var (
 		[]string{"command"},
 	)
 
+	ShortIDCollisions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "url_shortener_short_id_collisions_total",
+			Help: "Total number of generated short IDs that were already taken and had to be retried",
+		},
+		[]string{"generator"},
+	)
+
+	ShortenReused = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "url_shortener_shorten_reused_total",
+			Help: "Total number of shorten requests answered with an existing link",
+		},
+	)
+
+	PolicyRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "url_shortener_policy_rejections_total",
+			Help: "Total number of destination URL policy violations by code",
+		},
+		[]string{"code"},
+	)
+
+	BlockedRedirects = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "url_shortener_blocked_redirects_total",
+			Help: "Total number of redirects refused because the destination domain is blocked",
+		},
+	)
+
+	PasswordAttempts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "url_shortener_password_attempts_total",
+			Help: "Total number of password attempts on protected links by result (ok, wrong, limited)",
+		},
+		[]string{"result"},
+	)
+
+	TargetingMatches = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "url_shortener_targeting_matches_total",
+			Help: "Total number of redirects of links with targeting rules by outcome (rule, default)",
+		},
+		[]string{"result"},
+	)
+
+	VariantAssignments = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "url_shortener_variant_assignments_total",
+			Help: "Total number of redirects of split links by assignment (new, sticky)",
+		},
+		[]string{"assignment"},
+	)
+
+	DestinationParams = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "url_shortener_destination_params_total",
+			Help: "Total number of redirects whose destination got UTM or forwarded query parameters",
+		},
+	)
+
+	QRCodes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "url_shortener_qr_codes_total",
+			Help: "Total number of QR codes served by format and whether they came from the cache",
+		},
+		[]string{"format", "cached"},
+	)
+
+	ClickEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "url_shortener_click_events_total",
+			Help: "Total number of click events by outcome (stored, dropped, failed)",
+		},
+		[]string{"result"},
+	)
+
+	RateLimited = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_rate_limited_total",
+			Help: "Total number of requests rejected by the rate limiter by route",
+		},
+		[]string{"route"},
+	)
+
+	RateLimitErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "http_rate_limit_errors_total",
+			Help: "Total number of requests let through because the rate limiter failed",
+		},
+	)
+
 	InvalidTokens = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "auth_invalid_tokens_total",
@@ -98,6 +199,19 @@ func InitCustomMetrics() {
 	prometheus.MustRegister(RedisCacheHits)
 	prometheus.MustRegister(RedisCacheMisses)
 	prometheus.MustRegister(MongoOpDuration)
+	prometheus.MustRegister(PostgresOpDuration)
 	prometheus.MustRegister(RedisOpDuration)
+	prometheus.MustRegister(ShortIDCollisions)
+	prometheus.MustRegister(ShortenReused)
+	prometheus.MustRegister(PolicyRejections)
+	prometheus.MustRegister(BlockedRedirects)
+	prometheus.MustRegister(PasswordAttempts)
+	prometheus.MustRegister(TargetingMatches)
+	prometheus.MustRegister(VariantAssignments)
+	prometheus.MustRegister(DestinationParams)
+	prometheus.MustRegister(QRCodes)
+	prometheus.MustRegister(ClickEvents)
+	prometheus.MustRegister(RateLimited)
+	prometheus.MustRegister(RateLimitErrors)
 	prometheus.MustRegister(InvalidTokens)
 }
@@ -1,34 +1,92 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	auth "github.com/joaopaulo-bertoncini/url-shortener/internal/auth"
 	metrics "github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// principalKey is the gin context key holding the authenticated principal.
+const principalKey = "principal"
+
+// AuthMiddleware authenticates the bearer token against keys and stores the
+// resulting principal in the gin context.
+func AuthMiddleware(keys *auth.KeyManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			metrics.InvalidTokens.Inc()
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid token"})
-			return
+		if authenticate(c, keys) {
+			c.Next()
+		}
+	}
+}
+
+// OptionalAuthMiddleware is AuthMiddleware for routes that also serve
+// anonymous callers: requests without an Authorization header pass through
+// without a principal, but a bad token is still rejected.
+func OptionalAuthMiddleware(keys *auth.KeyManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" || authenticate(c, keys) {
+			c.Next()
 		}
+	}
+}
+
+// authenticate sets the principal, or aborts the request and returns false.
+func authenticate(c *gin.Context, keys *auth.KeyManager) bool {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+		metrics.InvalidTokens.Inc()
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid token"})
+		return false
+	}
+
+	providedToken := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+	principal, err := keys.Authenticate(c.Request.Context(), providedToken)
+	if errors.Is(err, auth.ErrInvalidKey) {
+		metrics.InvalidTokens.Inc()
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return false
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to verify token"})
+		return false
+	}
+
+	c.Set(principalKey, principal)
+	return true
+}
 
-		providedToken := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
-		expectedToken := os.Getenv("AUTH_TOKEN")
+// Principal returns the principal set by AuthMiddleware, or nil.
+func Principal(c *gin.Context) *auth.Principal {
+	p, _ := c.Get(principalKey)
+	principal, _ := p.(*auth.Principal)
+	return principal
+}
 
-		if providedToken != expectedToken {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+// RequireScope rejects authenticated requests whose key lacks scope.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !Principal(c).Can(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing scope " + scope})
 			return
 		}
+		c.Next()
+	}
+}
 
+// RequireAdmin rejects requests not made with an admin key.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p := Principal(c); p == nil || !p.Admin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin key required"})
+			return
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	logger "github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
+	metrics "github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	ratelimit "github.com/joaopaulo-bertoncini/url-shortener/internal/ratelimit"
+)
+
+// RateLimitMiddleware allows limit requests per client on route, where a
+// client is the API key of the principal set by AuthMiddleware or, for
+// anonymous requests, the client IP. Every response carries the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers; rejected
+// requests get 429 with Retry-After. Requests are let through when the
+// limiter fails.
+func RateLimitMiddleware(limiter ratelimit.Limiter, route string, limit ratelimit.Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !limit.Enabled() {
+			c.Next()
+			return
+		}
+
+		res, err := limiter.Allow(c.Request.Context(), route+":"+clientKey(c), limit)
+		if err != nil {
+			metrics.RateLimitErrors.Inc()
+			logger.Log.Warnf("Rate limiter error on %s: %v", route, err)
+			c.Next()
+			return
+		}
+
+		reset := strconv.Itoa(int(math.Ceil(res.Reset.Seconds())))
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", reset)
+		if !res.Allowed {
+			metrics.RateLimited.WithLabelValues(route).Inc()
+			c.Header("Retry-After", reset)
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// clientKey identifies the caller for rate limiting.
+func clientKey(c *gin.Context) string {
+	if p := Principal(c); p != nil {
+		if p.KeyID != "" {
+			return "key:" + p.KeyID
+		}
+		return "owner:" + p.Owner
+	}
+	return "ip:" + c.ClientIP()
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ratelimit "github.com/joaopaulo-bertoncini/url-shortener/internal/ratelimit"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	limit := ratelimit.Limit{Requests: 2, Window: time.Minute}
+	r.GET("/:shortID", RateLimitMiddleware(ratelimit.NewMemoryLimiter(), "redirect", limit), func(c *gin.Context) {
+		c.Status(http.StatusFound)
+	})
+
+	get := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/abc12345", nil)
+		req.RemoteAddr = ip + ":1234"
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := get("10.0.0.1")
+	assert.Equal(t, http.StatusFound, resp.Code)
+	assert.Equal(t, "2", resp.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", resp.Header().Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, resp.Header().Get("RateLimit-Reset"))
+
+	assert.Equal(t, http.StatusFound, get("10.0.0.1").Code)
+	resp = get("10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "0", resp.Header().Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, resp.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusFound, get("10.0.0.2").Code)
+}
+
+func TestRateLimitMiddleware_ForwardedHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	require.NoError(t, r.SetTrustedProxies([]string{"10.0.0.1"}))
+	limit := ratelimit.Limit{Requests: 2, Window: time.Minute}
+	r.GET("/:shortID", RateLimitMiddleware(ratelimit.NewMemoryLimiter(), "redirect", limit), func(c *gin.Context) {
+		c.Status(http.StatusFound)
+	})
+
+	get := func(peer, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/abc12345", nil)
+		req.RemoteAddr = peer + ":1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.Header.Set("X-Real-IP", forwardedFor)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	// A client talking to the service directly cannot pick its own bucket.
+	assert.Equal(t, http.StatusFound, get("203.0.113.7", "198.51.100.1"))
+	assert.Equal(t, http.StatusFound, get("203.0.113.7", "198.51.100.2"))
+	assert.Equal(t, http.StatusTooManyRequests, get("203.0.113.7", "198.51.100.3"))
+
+	// Behind a trusted proxy, every forwarded client has its own.
+	assert.Equal(t, http.StatusFound, get("10.0.0.1", "198.51.100.1"))
+	assert.Equal(t, http.StatusFound, get("10.0.0.1", "198.51.100.1"))
+	assert.Equal(t, http.StatusTooManyRequests, get("10.0.0.1", "198.51.100.1"))
+	assert.Equal(t, http.StatusFound, get("10.0.0.1", "198.51.100.2"))
+}
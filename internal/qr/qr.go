@@ -0,0 +1,246 @@
+// Package qr renders QR codes of short links as PNG or SVG images, entirely
+// in process, and keeps the most recently rendered images in memory.
+package qr
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+var ErrInvalidOptions = errors.New("invalid QR code options")
+
+type Format string
+
+const (
+	FormatPNG Format = "png"
+	FormatSVG Format = "svg"
+)
+
+// ContentType returns the MIME type of images in format f.
+func (f Format) ContentType() string {
+	if f == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// Size and margin bounds accepted by ParseOptions.
+const (
+	MinSize   = 64
+	MaxSize   = 2048
+	MaxMargin = 16
+)
+
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// Options controls how a QR code is rendered.
+type Options struct {
+	Format Format
+	// Size is the width and height of the image in pixels.
+	Size int
+	// Level is the error correction level: L, M, Q or H.
+	Level string
+	// Margin is the quiet zone around the code, in modules.
+	Margin     int
+	Foreground color.RGBA
+	Background color.RGBA
+	// Logo draws the generator's logo in the middle of the code. The error
+	// correction level is raised to H so the code stays readable.
+	Logo bool
+}
+
+// DefaultOptions renders a black on white 256 pixel PNG with level M and the
+// standard four module margin.
+func DefaultOptions() Options {
+	return Options{
+		Format:     FormatPNG,
+		Size:       256,
+		Level:      "M",
+		Margin:     4,
+		Foreground: color.RGBA{A: 0xff},
+		Background: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	}
+}
+
+// ParseOptions reads the query parameters format, size, level, margin, fg,
+// bg and logo, using DefaultOptions for those that are absent. Colors are
+// hex RGB values such as "1a2b3c" or "#1a2b3c".
+func ParseOptions(q url.Values) (Options, error) {
+	opts := DefaultOptions()
+	if v := q.Get("format"); v != "" {
+		opts.Format = Format(strings.ToLower(v))
+		if opts.Format != FormatPNG && opts.Format != FormatSVG {
+			return opts, fmt.Errorf("%w: format must be png or svg", ErrInvalidOptions)
+		}
+	}
+	if v := q.Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < MinSize || n > MaxSize {
+			return opts, fmt.Errorf("%w: size must be between %d and %d", ErrInvalidOptions, MinSize, MaxSize)
+		}
+		opts.Size = n
+	}
+	if v := q.Get("level"); v != "" {
+		opts.Level = strings.ToUpper(v)
+		if _, ok := levels[opts.Level]; !ok {
+			return opts, fmt.Errorf("%w: level must be L, M, Q or H", ErrInvalidOptions)
+		}
+	}
+	if v := q.Get("margin"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > MaxMargin {
+			return opts, fmt.Errorf("%w: margin must be between 0 and %d", ErrInvalidOptions, MaxMargin)
+		}
+		opts.Margin = n
+	}
+	for name, dst := range map[string]*color.RGBA{"fg": &opts.Foreground, "bg": &opts.Background} {
+		if v := q.Get(name); v != "" {
+			c, err := parseColor(v)
+			if err != nil {
+				return opts, fmt.Errorf("%w: %s: %v", ErrInvalidOptions, name, err)
+			}
+			*dst = c
+		}
+	}
+	if v := q.Get("logo"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("%w: logo must be true or false", ErrInvalidOptions)
+		}
+		opts.Logo = b
+	}
+	return opts, nil
+}
+
+func parseColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return color.RGBA{}, fmt.Errorf("color %q is not a 6 digit hex value", s)
+	}
+	n, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("color %q is not a 6 digit hex value", s)
+	}
+	return color.RGBA{R: uint8(n >> 16), G: uint8(n >> 8), B: uint8(n), A: 0xff}, nil
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// key identifies the image of content rendered with o.
+func (o Options) key(content string) string {
+	return fmt.Sprintf("%s|%d|%s|%d|%s|%s|%t|%s", o.Format, o.Size, o.Level, o.Margin,
+		hexColor(o.Foreground), hexColor(o.Background), o.Logo, content)
+}
+
+// Generator renders QR codes and caches the results.
+type Generator struct {
+	logo image.Image
+
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of *cached, most recently used first
+	entries map[string]*list.Element
+}
+
+type cached struct {
+	key   string
+	image []byte
+}
+
+// NewGenerator returns a Generator that keeps up to cacheSize images; zero
+// disables the cache. logo may be nil, in which case requests for a logo fail.
+func NewGenerator(logo image.Image, cacheSize int) *Generator {
+	return &Generator{
+		logo:    logo,
+		size:    cacheSize,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// HasLogo reports whether codes can be rendered with a logo.
+func (g *Generator) HasLogo() bool {
+	return g.logo != nil
+}
+
+// Generate returns the image encoding content. The second return value
+// reports whether it came from the cache.
+func (g *Generator) Generate(content string, opts Options) ([]byte, bool, error) {
+	if opts.Logo && g.logo == nil {
+		return nil, false, fmt.Errorf("%w: no logo is configured", ErrInvalidOptions)
+	}
+	key := opts.key(content)
+	if img, ok := g.get(key); ok {
+		return img, true, nil
+	}
+
+	level, ok := levels[opts.Level]
+	if !ok {
+		return nil, false, fmt.Errorf("%w: level must be L, M, Q or H", ErrInvalidOptions)
+	}
+	if opts.Logo {
+		level = qrcode.Highest
+	}
+	code, err := qrcode.New(content, level)
+	if err != nil {
+		return nil, false, err
+	}
+	code.DisableBorder = true
+
+	var img []byte
+	if opts.Format == FormatSVG {
+		img, err = g.renderSVG(code.Bitmap(), opts)
+	} else {
+		img, err = g.renderPNG(code.Bitmap(), opts)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	g.put(key, img)
+	return img, false, nil
+}
+
+func (g *Generator) get(key string) ([]byte, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	el, ok := g.entries[key]
+	if !ok {
+		return nil, false
+	}
+	g.order.MoveToFront(el)
+	return el.Value.(*cached).image, true
+}
+
+func (g *Generator) put(key string, img []byte) {
+	if g.size <= 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if el, ok := g.entries[key]; ok {
+		g.order.MoveToFront(el)
+		return
+	}
+	g.entries[key] = g.order.PushFront(&cached{key: key, image: img})
+	for g.order.Len() > g.size {
+		oldest := g.order.Back()
+		g.order.Remove(oldest)
+		delete(g.entries, oldest.Value.(*cached).key)
+	}
+}
@@ -0,0 +1,110 @@
+package qr
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"strings"
+	"testing"
+
+	qrcode "github.com/skip2/go-qrcode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOptions(t *testing.T) {
+	opts, err := ParseOptions(url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultOptions(), opts)
+
+	opts, err = ParseOptions(url.Values{"format": {"SVG"}, "size": {"512"}, "level": {"h"}, "margin": {"0"}, "fg": {"#1a2b3c"}, "bg": {"ffffff"}})
+	require.NoError(t, err)
+	assert.Equal(t, FormatSVG, opts.Format)
+	assert.Equal(t, 512, opts.Size)
+	assert.Equal(t, "H", opts.Level)
+	assert.Equal(t, 0, opts.Margin)
+	assert.Equal(t, color.RGBA{R: 0x1a, G: 0x2b, B: 0x3c, A: 0xff}, opts.Foreground)
+
+	for _, q := range []url.Values{
+		{"format": {"gif"}},
+		{"size": {"10"}},
+		{"size": {"big"}},
+		{"level": {"X"}},
+		{"margin": {"-1"}},
+		{"fg": {"red"}},
+		{"logo": {"maybe"}},
+	} {
+		_, err := ParseOptions(q)
+		assert.ErrorIs(t, err, ErrInvalidOptions, q.Encode())
+	}
+}
+
+func TestGenerator_PNG(t *testing.T) {
+	g := NewGenerator(nil, 8)
+	opts := DefaultOptions()
+	opts.Foreground = color.RGBA{R: 0x10, G: 0x20, B: 0x30, A: 0xff}
+
+	data, hit, err := g.Generate("http://localhost:8080/abc123", opts)
+	require.NoError(t, err)
+	assert.False(t, hit)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 256, 256), img.Bounds())
+	// The corner is quiet zone; just inside it is the top-left finder pattern.
+	code, err := qrcode.New("http://localhost:8080/abc123", qrcode.Medium)
+	require.NoError(t, err)
+	code.DisableBorder = true
+	l := newLayout(len(code.Bitmap()), opts)
+	assertColor(t, opts.Background, img.At(l.offset-1, l.offset-1))
+	assertColor(t, opts.Background, img.At(0, 0))
+	assertColor(t, opts.Foreground, img.At(l.offset, l.offset))
+
+	again, hit, err := g.Generate("http://localhost:8080/abc123", opts)
+	require.NoError(t, err)
+	assert.True(t, hit)
+	assert.Equal(t, data, again)
+
+	_, _, err = g.Generate("http://localhost:8080/abc123", Options{Format: FormatPNG, Size: 256, Level: "M", Logo: true})
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+}
+
+func TestGenerator_SVGWithLogo(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	g := NewGenerator(logo, 0)
+	opts := DefaultOptions()
+	opts.Format = FormatSVG
+	opts.Logo = true
+
+	data, _, err := g.Generate("http://localhost:8080/abc123", opts)
+	require.NoError(t, err)
+	svg := string(data)
+	assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="256" height="256"`))
+	assert.Contains(t, svg, `<path fill="#000000" d="M`)
+	assert.Contains(t, svg, `href="data:image/png;base64,`)
+
+	_, hit, err := g.Generate("http://localhost:8080/abc123", opts)
+	require.NoError(t, err)
+	assert.False(t, hit, "a zero cache size disables caching")
+}
+
+func TestGenerator_CacheEvictsLeastRecentlyUsed(t *testing.T) {
+	g := NewGenerator(nil, 2)
+	opts := DefaultOptions()
+	for _, content := range []string{"a", "b", "a", "c"} {
+		_, _, err := g.Generate(content, opts)
+		require.NoError(t, err)
+	}
+	_, hit, _ := g.Generate("a", opts)
+	assert.True(t, hit)
+	_, hit, _ = g.Generate("b", opts)
+	assert.False(t, hit)
+}
+
+func assertColor(t *testing.T, want color.RGBA, got color.Color) {
+	t.Helper()
+	r, g, b, _ := got.RGBA()
+	assert.Equal(t, [3]uint8{want.R, want.G, want.B}, [3]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)})
+}
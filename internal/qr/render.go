@@ -0,0 +1,139 @@
+package qr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg" // logos may be JPEG files
+	"image/png"
+	"os"
+)
+
+// LoadLogo decodes a PNG or JPEG logo from path.
+func LoadLogo(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decode logo %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// layout positions the modules of a code inside the image. Modules are whole
+// pixels so edges stay sharp; the leftover space is split around the code.
+type layout struct {
+	dim    int // width and height of the image
+	scale  int // pixels per module
+	offset int // position of the first module
+	width  int // pixels covered by the modules
+}
+
+func newLayout(modules int, opts Options) layout {
+	total := modules + 2*opts.Margin
+	dim := max(opts.Size, total)
+	scale := dim / total
+	return layout{
+		dim:    dim,
+		scale:  scale,
+		offset: (dim-total*scale)/2 + opts.Margin*scale,
+		width:  modules * scale,
+	}
+}
+
+// logoRect is the area covered by the logo, a fifth of the code's width
+// surrounded by one module of background.
+func (l layout) logoRect() (pad, logo image.Rectangle) {
+	side := l.width / 5
+	start := l.offset + (l.width-side)/2
+	logo = image.Rect(start, start, start+side, start+side)
+	return logo.Inset(-l.scale), logo
+}
+
+func (g *Generator) renderPNG(bitmap [][]bool, opts Options) ([]byte, error) {
+	l := newLayout(len(bitmap), opts)
+	img := image.NewRGBA(image.Rect(0, 0, l.dim, l.dim))
+	draw.Draw(img, img.Bounds(), image.NewUniform(opts.Background), image.Point{}, draw.Src)
+	fg := image.NewUniform(opts.Foreground)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				px, py := l.offset+x*l.scale, l.offset+y*l.scale
+				draw.Draw(img, image.Rect(px, py, px+l.scale, py+l.scale), fg, image.Point{}, draw.Src)
+			}
+		}
+	}
+	if opts.Logo {
+		pad, rect := l.logoRect()
+		draw.Draw(img, pad, image.NewUniform(opts.Background), image.Point{}, draw.Src)
+		draw.Draw(img, rect, scaleImage(g.logo, rect.Dx()), image.Point{}, draw.Over)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleImage resizes src to a side x side square with nearest-neighbour
+// sampling, keeping its aspect ratio.
+func scaleImage(src image.Image, side int) image.Image {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	longest := max(b.Dx(), b.Dy())
+	if longest == 0 || side == 0 {
+		return dst
+	}
+	w, h := b.Dx()*side/longest, b.Dy()*side/longest
+	ox, oy := (side-w)/2, (side-h)/2
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dst.Set(ox+x, oy+y, src.At(b.Min.X+x*longest/side, b.Min.Y+y*longest/side))
+		}
+	}
+	return dst
+}
+
+func (g *Generator) renderSVG(bitmap [][]bool, opts Options) ([]byte, error) {
+	l := newLayout(len(bitmap), opts)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		l.dim, l.dim, l.dim, l.dim)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="%s"/>`, l.dim, l.dim, hexColor(opts.Background))
+	fmt.Fprintf(&buf, `<path fill="%s" d="`, hexColor(opts.Foreground))
+	// One subpath per horizontal run of dark modules.
+	for y, row := range bitmap {
+		for x := 0; x < len(row); {
+			if !row[x] {
+				x++
+				continue
+			}
+			run := 1
+			for x+run < len(row) && row[x+run] {
+				run++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv%dh-%dz", l.offset+x*l.scale, l.offset+y*l.scale, run*l.scale, l.scale, run*l.scale)
+			x += run
+		}
+	}
+	buf.WriteString(`"/>`)
+	if opts.Logo {
+		pad, rect := l.logoRect()
+		var logo bytes.Buffer
+		if err := png.Encode(&logo, g.logo); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`,
+			pad.Min.X, pad.Min.Y, pad.Dx(), pad.Dy(), hexColor(opts.Background))
+		fmt.Fprintf(&buf, `<image x="%d" y="%d" width="%d" height="%d" href="data:image/png;base64,%s"/>`,
+			rect.Min.X, rect.Min.Y, rect.Dx(), rect.Dy(), base64.StdEncoding.EncodeToString(logo.Bytes()))
+	}
+	buf.WriteString("</svg>\n")
+	return buf.Bytes(), nil
+}
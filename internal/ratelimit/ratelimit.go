@@ -0,0 +1,169 @@
+// Package ratelimit counts requests per client with a sliding window, either
+// in Redis, shared by every instance of the service, or in process.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidLimit = errors.New(`rate limit must look like "100/1m"`)
+
+// Limit allows Requests per Window. The zero Limit disables limiting.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Enabled reports whether l restricts anything.
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Window > 0
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Window)
+}
+
+// ParseLimit parses "<requests>/<window>", such as "100/1m" or "10/1s".
+// "off", "0" and the empty string yield the zero Limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" || strings.EqualFold(s, "off") {
+		return Limit{}, nil
+	}
+	requests, window, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, ErrInvalidLimit
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return Limit{}, ErrInvalidLimit
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Limit{}, ErrInvalidLimit
+	}
+	return Limit{Requests: n, Window: d}, nil
+}
+
+// Result is the outcome of a single Allow call.
+type Result struct {
+	Allowed bool
+	Limit   int
+	// Remaining is the number of requests still allowed in the current window.
+	Remaining int
+	// Reset is the time until the current window ends.
+	Reset time.Duration
+}
+
+// Limiter counts a request against key and reports whether it is allowed.
+// Rejected requests are not counted.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// window splits now into the fixed window it falls in and the fraction of the
+// previous window still covered by the sliding window.
+func window(now time.Time, size time.Duration) (index int64, prevWeight float64, reset time.Duration) {
+	ns := now.UnixNano()
+	index = ns / int64(size)
+	elapsed := time.Duration(ns % int64(size))
+	return index, 1 - float64(elapsed)/float64(size), size - elapsed
+}
+
+// estimate approximates the requests in the sliding window ending now from the
+// counters of the current and previous fixed windows.
+func estimate(prev, cur int64, prevWeight float64) int64 {
+	return int64(math.Floor(float64(prev)*prevWeight)) + cur
+}
+
+func result(limit Limit, count int64, allowed bool, reset time.Duration) Result {
+	remaining := int64(limit.Requests) - count
+	if remaining < 0 {
+		remaining = 0
+	}
+	return Result{Allowed: allowed, Limit: limit.Requests, Remaining: int(remaining), Reset: reset}
+}
+
+// MemoryLimiter is a Limiter for a single instance of the service.
+type MemoryLimiter struct {
+	mu       sync.Mutex
+	counters map[string]*memoryCounter
+	now      func() time.Time
+}
+
+type memoryCounter struct {
+	index     int64
+	prev, cur int64
+	seen      time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{counters: make(map[string]*memoryCounter), now: time.Now}
+}
+
+func (l *MemoryLimiter) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	if !limit.Enabled() {
+		return Result{Allowed: true}, nil
+	}
+	now := l.now()
+	index, weight, reset := window(now, limit.Window)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c, ok := l.counters[key]
+	if !ok {
+		c = &memoryCounter{index: index}
+		l.counters[key] = c
+	}
+	switch {
+	case c.index == index-1:
+		c.prev, c.cur = c.cur, 0
+	case c.index != index:
+		c.prev, c.cur = 0, 0
+	}
+	c.index, c.seen = index, now
+
+	count := estimate(c.prev, c.cur, weight)
+	if count >= int64(limit.Requests) {
+		return result(limit, count, false, reset), nil
+	}
+	c.cur++
+	return result(limit, count+1, true, reset), nil
+}
+
+// Sweep drops the counters untouched for two windows of maxWindow, which no
+// longer affect any sliding window.
+func (l *MemoryLimiter) Sweep(maxWindow time.Duration) {
+	cutoff := l.now().Add(-2 * maxWindow)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, c := range l.counters {
+		if c.seen.Before(cutoff) {
+			delete(l.counters, key)
+		}
+	}
+}
+
+// RunSweeper calls Sweep every maxWindow until ctx is done.
+func (l *MemoryLimiter) RunSweeper(ctx context.Context, maxWindow time.Duration) {
+	ticker := time.NewTicker(maxWindow)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.Sweep(maxWindow)
+		}
+	}
+}
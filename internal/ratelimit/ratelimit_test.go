@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	l, err := ParseLimit("100/1m")
+	require.NoError(t, err)
+	assert.Equal(t, Limit{Requests: 100, Window: time.Minute}, l)
+
+	for _, off := range []string{"", "0", "off", "OFF"} {
+		l, err := ParseLimit(off)
+		require.NoError(t, err)
+		assert.False(t, l.Enabled(), off)
+	}
+
+	for _, bad := range []string{"100", "x/1m", "-1/1m", "10/0s", "10/soon"} {
+		_, err := ParseLimit(bad)
+		assert.ErrorIs(t, err, ErrInvalidLimit, bad)
+	}
+}
+
+func TestMemoryLimiter_SlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	limit := Limit{Requests: 4, Window: time.Minute}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := NewMemoryLimiter()
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 4; i++ {
+		res, err := l.Allow(ctx, "client", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3-i, res.Remaining)
+	}
+	res, err := l.Allow(ctx, "client", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, time.Minute, res.Reset)
+
+	res, err = l.Allow(ctx, "other", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed, "keys are counted separately")
+
+	// Halfway through the next window, half of the previous one still counts.
+	now = now.Add(90 * time.Second)
+	for i := 0; i < 2; i++ {
+		res, err = l.Allow(ctx, "client", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+	}
+	res, err = l.Allow(ctx, "client", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 30*time.Second, res.Reset)
+
+	now = now.Add(3 * time.Minute)
+	l.Sweep(time.Minute)
+	assert.Empty(t, l.counters)
+}
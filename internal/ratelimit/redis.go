@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+// slidingWindowScript applies the sliding window in a single round trip.
+// KEYS are the counters of the current and previous fixed windows; ARGV is the
+// limit, the weight of the previous window and the window size in ms. It
+// returns whether the request was allowed and the estimated count.
+var slidingWindowScript = redis.NewScript(`
+local cur = tonumber(redis.call('GET', KEYS[1]) or '0')
+local prev = tonumber(redis.call('GET', KEYS[2]) or '0')
+local count = math.floor(prev * tonumber(ARGV[2])) + cur
+if count >= tonumber(ARGV[1]) then
+	return {0, count}
+end
+redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], 2 * tonumber(ARGV[3]))
+return {1, count + 1}
+`)
+
+// RedisLimiter is a Limiter shared by every instance using the same Redis.
+type RedisLimiter struct {
+	client *redis.Client
+	prefix string
+	now    func() time.Time
+}
+
+func NewRedisLimiter(client *redis.Client) *RedisLimiter {
+	return &RedisLimiter{client: client, prefix: "ratelimit:", now: time.Now}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if !limit.Enabled() {
+		return Result{Allowed: true}, nil
+	}
+	index, weight, reset := window(l.now(), limit.Window)
+	base := l.prefix + key + ":" + strconv.FormatInt(int64(limit.Window/time.Millisecond), 10) + ":"
+
+	start := time.Now()
+	res, err := slidingWindowScript.Run(ctx, l.client,
+		[]string{base + strconv.FormatInt(index, 10), base + strconv.FormatInt(index-1, 10)},
+		limit.Requests, strconv.FormatFloat(weight, 'f', 6, 64), limit.Window.Milliseconds(),
+	).Int64Slice()
+	metrics.RedisOpDuration.WithLabelValues("RATE_LIMIT").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return Result{}, fmt.Errorf("rate limit script failed: %w", err)
+	}
+	if len(res) != 2 {
+		return Result{}, fmt.Errorf("rate limit script returned %d values", len(res))
+	}
+	return result(limit, res[1], res[0] == 1, reset), nil
+}
@@ -0,0 +1,278 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	urlsBucket     = []byte("urls")
+	countersBucket = []byte("counters")
+	clicksBucket   = []byte("clicks")
+	keysBucket     = []byte("api_keys")
+	domainsBucket  = []byte("domain_rules")
+	utmBucket      = []byte("owner_utm")
+)
+
+// OpenBolt opens the bbolt file at path and creates every bucket the bolt
+// stores use. The stores share the returned handle since bbolt locks the file.
+func OpenBolt(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{urlsBucket, countersBucket, clicksBucket, keysBucket, domainsBucket, utmBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize bolt database: %w", err)
+	}
+	log.Printf("✅ Opened bolt database at %s", path)
+	return db, nil
+}
+
+// BoltLinkStore persists links in a single bbolt file, keyed by short ID.
+type BoltLinkStore struct {
+	db *bolt.DB
+}
+
+func NewBoltLinkStore(db *bolt.DB) *BoltLinkStore {
+	return &BoltLinkStore{db: db}
+}
+
+func (s *BoltLinkStore) Create(ctx context.Context, m *URLMapping) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(urlsBucket)
+		if b.Get([]byte(m.ShortID)) != nil {
+			return ErrDuplicate
+		}
+		return b.Put([]byte(m.ShortID), data)
+	})
+}
+
+// errBatchRejected rolls back an atomic CreateMany transaction.
+var errBatchRejected = errors.New("batch rejected")
+
+func (s *BoltLinkStore) CreateMany(ctx context.Context, links []*URLMapping, atomic bool) ([]error, error) {
+	errs := make([]error, len(links))
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(urlsBucket)
+		failed := false
+		for i, m := range links {
+			if b.Get([]byte(m.ShortID)) != nil {
+				errs[i] = ErrDuplicate
+				failed = true
+				continue
+			}
+			data, err := json.Marshal(m)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(m.ShortID), data); err != nil {
+				return err
+			}
+		}
+		if atomic && failed {
+			return errBatchRejected
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchRejected) {
+		return nil, err
+	}
+	return errs, nil
+}
+
+func (s *BoltLinkStore) Get(ctx context.Context, shortID string) (*URLMapping, error) {
+	var result URLMapping
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(urlsBucket).Get([]byte(shortID))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *BoltLinkStore) Delete(ctx context.Context, shortID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(urlsBucket)
+		if b.Get([]byte(shortID)) == nil {
+			return ErrNotFound
+		}
+		return b.Delete([]byte(shortID))
+	})
+}
+
+func (s *BoltLinkStore) Update(ctx context.Context, m *URLMapping) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(urlsBucket)
+		data := b.Get([]byte(m.ShortID))
+		if data == nil {
+			return ErrNotFound
+		}
+		var cur URLMapping
+		if err := json.Unmarshal(data, &cur); err != nil {
+			return err
+		}
+		if cur.Version != m.Version {
+			return ErrConflict
+		}
+		updated := *m
+		updated.AccessCount = cur.AccessCount
+		updated.VariantClicks = cur.VariantClicks
+		updated.Version++
+		encoded, err := json.Marshal(&updated)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(m.ShortID), encoded); err != nil {
+			return err
+		}
+		m.Version = updated.Version
+		return nil
+	})
+}
+
+func (s *BoltLinkStore) IncrementAccessCount(ctx context.Context, shortID string) (*URLMapping, error) {
+	var result URLMapping
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(urlsBucket)
+		data := b.Get([]byte(shortID))
+		if data == nil {
+			return ErrNotFound
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return err
+		}
+		if result.MaxClicks > 0 && result.AccessCount >= result.MaxClicks {
+			return ErrExhausted
+		}
+		result.AccessCount++
+		updated, err := json.Marshal(&result)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(shortID), updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *BoltLinkStore) IncrementVariantCount(ctx context.Context, shortID, variantID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(urlsBucket)
+		data := b.Get([]byte(shortID))
+		if data == nil {
+			return ErrNotFound
+		}
+		var m URLMapping
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		m.VariantClicks = incrementVariant(m.VariantClicks, variantID)
+		updated, err := json.Marshal(&m)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(shortID), updated)
+	})
+}
+
+func (s *BoltLinkStore) List(ctx context.Context, opts ListOptions) ([]URLMapping, error) {
+	links, err := s.all()
+	if err != nil {
+		return nil, err
+	}
+	return selectLinks(links, opts), nil
+}
+
+func (s *BoltLinkStore) Count(ctx context.Context, filter LinkFilter) (int64, error) {
+	links, err := s.all()
+	if err != nil {
+		return 0, err
+	}
+	return countLinks(links, filter), nil
+}
+
+func (s *BoltLinkStore) FindReusable(ctx context.Context, owner, normalizedURL string) (*URLMapping, error) {
+	links, err := s.all()
+	if err != nil {
+		return nil, err
+	}
+	return findReusable(links, owner, normalizedURL)
+}
+
+// all loads every link; the bolt store has no secondary indexes, so listing
+// is a full scan.
+func (s *BoltLinkStore) all() ([]URLMapping, error) {
+	results := []URLMapping{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(urlsBucket).ForEach(func(k, v []byte) error {
+			var m URLMapping
+			if err := json.Unmarshal(v, &m); err != nil {
+				return err
+			}
+			results = append(results, m)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *BoltLinkStore) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	var n int64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(urlsBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var m URLMapping
+			if err := json.Unmarshal(v, &m); err != nil {
+				return err
+			}
+			if !m.Expired(now) {
+				continue
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+func (s *BoltLinkStore) NextSequence(ctx context.Context) (uint64, error) {
+	var n uint64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.Bucket(countersBucket).NextSequence()
+		return err
+	})
+	return n, err
+}
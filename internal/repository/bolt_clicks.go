@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltClickStore keeps click events in the "clicks" bucket under
+// short_id NUL timestamp sequence keys, so a link's events sort by time.
+type BoltClickStore struct {
+	db *bolt.DB
+}
+
+func NewBoltClickStore(db *bolt.DB) *BoltClickStore {
+	return &BoltClickStore{db: db}
+}
+
+func clickKey(shortID string, ts time.Time, seq uint64) []byte {
+	key := make([]byte, 0, len(shortID)+17)
+	key = append(key, shortID...)
+	key = append(key, 0)
+	key = binary.BigEndian.AppendUint64(key, uint64(ts.UnixNano()))
+	return binary.BigEndian.AppendUint64(key, seq)
+}
+
+func (s *BoltClickStore) InsertClicks(ctx context.Context, events []ClickEvent) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(clicksBucket)
+		for _, ev := range events {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(clickKey(ev.ShortID, ev.Timestamp, seq), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltClickStore) ListClicks(ctx context.Context, shortID string, from, to time.Time) ([]ClickEvent, error) {
+	results := []ClickEvent{}
+	start := clickKey(shortID, from, 0)
+	end := clickKey(shortID, to, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(clicksBucket).Cursor()
+		for k, v := c.Seek(start); k != nil && bytes.Compare(k, end) < 0; k, v = c.Next() {
+			var ev ClickEvent
+			if err := json.Unmarshal(v, &ev); err != nil {
+				return err
+			}
+			results = append(results, ev)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
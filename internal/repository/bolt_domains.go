@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltDomainStore keeps domain rules in the "domain_rules" bucket, keyed by
+// domain, which also keeps them sorted.
+type BoltDomainStore struct {
+	db *bolt.DB
+}
+
+func NewBoltDomainStore(db *bolt.DB) *BoltDomainStore {
+	return &BoltDomainStore{db: db}
+}
+
+func (s *BoltDomainStore) PutDomainRule(ctx context.Context, rule *DomainRule) error {
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(domainsBucket).Put([]byte(rule.Domain), data)
+	})
+}
+
+func (s *BoltDomainStore) DeleteDomainRule(ctx context.Context, domain string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(domainsBucket)
+		if b.Get([]byte(domain)) == nil {
+			return ErrNotFound
+		}
+		return b.Delete([]byte(domain))
+	})
+}
+
+func (s *BoltDomainStore) ListDomainRules(ctx context.Context) ([]DomainRule, error) {
+	results := []DomainRule{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(domainsBucket).ForEach(func(_, v []byte) error {
+			var rule DomainRule
+			if err := json.Unmarshal(v, &rule); err != nil {
+				return err
+			}
+			results = append(results, rule)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltKeyStore keeps API keys in the "api_keys" bucket, keyed by key ID.
+type BoltKeyStore struct {
+	db *bolt.DB
+}
+
+func NewBoltKeyStore(db *bolt.DB) *BoltKeyStore {
+	return &BoltKeyStore{db: db}
+}
+
+func (s *BoltKeyStore) CreateKey(ctx context.Context, key *APIKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(keysBucket)
+		if b.Get([]byte(key.ID)) != nil {
+			return ErrDuplicate
+		}
+		return b.Put([]byte(key.ID), data)
+	})
+}
+
+func (s *BoltKeyStore) GetKey(ctx context.Context, id string) (*APIKey, error) {
+	var key APIKey
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(keysBucket).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *BoltKeyStore) ListKeys(ctx context.Context, owner string) ([]APIKey, error) {
+	results := []APIKey{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(keysBucket).ForEach(func(_, v []byte) error {
+			var key APIKey
+			if err := json.Unmarshal(v, &key); err != nil {
+				return err
+			}
+			if owner == "" || key.Owner == owner {
+				results = append(results, key)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].CreatedAt.Before(results[j].CreatedAt) })
+	return results, nil
+}
+
+func (s *BoltKeyStore) UpdateKey(ctx context.Context, key *APIKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(keysBucket)
+		if b.Get([]byte(key.ID)) == nil {
+			return ErrNotFound
+		}
+		return b.Put([]byte(key.ID), data)
+	})
+}
+
+func (s *BoltKeyStore) TouchKey(ctx context.Context, id string, at time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(keysBucket)
+		data := b.Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		var key APIKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			return err
+		}
+		key.LastUsedAt = &at
+		updated, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), updated)
+	})
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltUTMStore keeps owner UTM templates in the "owner_utm" bucket, keyed by
+// owner.
+type BoltUTMStore struct {
+	db *bolt.DB
+}
+
+func NewBoltUTMStore(db *bolt.DB) *BoltUTMStore {
+	return &BoltUTMStore{db: db}
+}
+
+func (s *BoltUTMStore) PutOwnerUTM(ctx context.Context, t *OwnerUTM) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(utmBucket).Put([]byte(t.Owner), data)
+	})
+}
+
+func (s *BoltUTMStore) GetOwnerUTM(ctx context.Context, owner string) (*OwnerUTM, error) {
+	var t OwnerUTM
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(utmBucket).Get([]byte(owner))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *BoltUTMStore) DeleteOwnerUTM(ctx context.Context, owner string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(utmBucket)
+		if b.Get([]byte(owner)) == nil {
+			return ErrNotFound
+		}
+		return b.Delete([]byte(owner))
+	})
+}
+
+func (s *BoltUTMStore) ListOwnerUTM(ctx context.Context) ([]OwnerUTM, error) {
+	results := []OwnerUTM{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(utmBucket).ForEach(func(_, v []byte) error {
+			var t OwnerUTM
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			results = append(results, t)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	BackendMongo    = "mongo"
+	BackendMemory   = "memory"
+	BackendBolt     = "bolt"
+	BackendPostgres = "postgres"
+
+	CacheRedis  = "redis"
+	CacheMemory = "memory"
+)
+
+// Config selects the storage and cache backends.
+type Config struct {
+	Backend     string
+	MongoURI    string
+	BoltPath    string
+	PostgresDSN string
+
+	Cache     string
+	RedisAddr string
+}
+
+// ConfigFromEnv reads STORAGE_BACKEND, MONGO_URI, BOLT_PATH, POSTGRES_DSN,
+// CACHE_BACKEND and REDIS_ADDR. Without explicit settings the service keeps
+// using Mongo and Redis; the embedded backends default to an in-process cache
+// unless REDIS_ADDR is set.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Backend:     strings.ToLower(os.Getenv("STORAGE_BACKEND")),
+		MongoURI:    os.Getenv("MONGO_URI"),
+		BoltPath:    os.Getenv("BOLT_PATH"),
+		PostgresDSN: os.Getenv("POSTGRES_DSN"),
+		Cache:       strings.ToLower(os.Getenv("CACHE_BACKEND")),
+		RedisAddr:   os.Getenv("REDIS_ADDR"),
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = BackendMongo
+	}
+	if cfg.BoltPath == "" {
+		cfg.BoltPath = "shortener.db"
+	}
+	if cfg.Cache == "" {
+		cfg.Cache = CacheRedis
+		if (cfg.Backend == BackendMemory || cfg.Backend == BackendBolt) && cfg.RedisAddr == "" {
+			cfg.Cache = CacheMemory
+		}
+	}
+	return cfg
+}
+
+// Stores bundles the backends selected by a Config.
+type Stores struct {
+	Links   LinkStore
+	Clicks  ClickStore
+	Keys    KeyStore
+	Domains DomainStore
+	UTM     UTMStore
+	Cache   Cache
+	// Redis is the client behind a Redis cache, or nil.
+	Redis *redis.Client
+
+	closers []func(context.Context) error
+}
+
+// Close releases every connection opened by Open.
+func (s *Stores) Close(ctx context.Context) {
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		_ = s.closers[i](ctx)
+	}
+}
+
+func Open(ctx context.Context, cfg Config) (*Stores, error) {
+	stores := &Stores{}
+
+	switch cfg.Backend {
+	case BackendMongo:
+		client, err := NewMongoClient(ctx, cfg.MongoURI)
+		if err != nil {
+			return nil, err
+		}
+		stores.closers = append(stores.closers, client.Disconnect)
+		db := client.Database("shortener")
+		links, clicks, keys, domains, utm := NewMongoLinkStore(db), NewMongoClickStore(db), NewMongoKeyStore(db), NewMongoDomainStore(db), NewMongoUTMStore(db)
+		for _, ensure := range []func(context.Context) error{links.EnsureIndexes, clicks.EnsureIndexes, keys.EnsureIndexes, domains.EnsureIndexes, utm.EnsureIndexes} {
+			if err := ensure(ctx); err != nil {
+				stores.Close(ctx)
+				return nil, err
+			}
+		}
+		stores.Links, stores.Clicks, stores.Keys, stores.Domains, stores.UTM = links, clicks, keys, domains, utm
+	case BackendMemory:
+		stores.Links = NewMemoryLinkStore()
+		stores.Clicks = NewMemoryClickStore()
+		stores.Keys = NewMemoryKeyStore()
+		stores.Domains = NewMemoryDomainStore()
+		stores.UTM = NewMemoryUTMStore()
+	case BackendBolt:
+		db, err := OpenBolt(cfg.BoltPath)
+		if err != nil {
+			return nil, err
+		}
+		stores.closers = append(stores.closers, func(context.Context) error { return db.Close() })
+		stores.Links = NewBoltLinkStore(db)
+		stores.Clicks = NewBoltClickStore(db)
+		stores.Keys = NewBoltKeyStore(db)
+		stores.Domains = NewBoltDomainStore(db)
+		stores.UTM = NewBoltUTMStore(db)
+	case BackendPostgres:
+		db, err := NewPostgresDB(ctx, cfg.PostgresDSN)
+		if err != nil {
+			return nil, err
+		}
+		stores.closers = append(stores.closers, func(context.Context) error { return db.Close() })
+		if err := Migrate(ctx, db); err != nil {
+			stores.Close(ctx)
+			return nil, err
+		}
+		stores.Links = NewPostgresLinkStore(db)
+		stores.Clicks = NewPostgresClickStore(db)
+		stores.Keys = NewPostgresKeyStore(db)
+		stores.Domains = NewPostgresDomainStore(db)
+		stores.UTM = NewPostgresUTMStore(db)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+
+	switch cfg.Cache {
+	case CacheRedis:
+		client, err := NewRedisClient(ctx, cfg.RedisAddr)
+		if err != nil {
+			stores.Close(ctx)
+			return nil, err
+		}
+		stores.closers = append(stores.closers, func(context.Context) error { return client.Close() })
+		stores.Cache = NewRedisCache(client)
+		stores.Redis = client
+	case CacheMemory:
+		stores.Cache = NewMemoryCache()
+	default:
+		stores.Close(ctx)
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Cache)
+	}
+
+	return stores, nil
+}
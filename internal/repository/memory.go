@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MemoryLinkStore keeps links in process memory. Data is lost on restart,
+// which makes it suitable for development, tests and throwaway deployments.
+type MemoryLinkStore struct {
+	mu    sync.RWMutex
+	links map[string]URLMapping
+	seq   atomic.Uint64
+}
+
+func NewMemoryLinkStore() *MemoryLinkStore {
+	return &MemoryLinkStore{links: make(map[string]URLMapping)}
+}
+
+func (s *MemoryLinkStore) Create(ctx context.Context, m *URLMapping) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.links[m.ShortID]; ok {
+		return ErrDuplicate
+	}
+	s.links[m.ShortID] = *m
+	return nil
+}
+
+func (s *MemoryLinkStore) CreateMany(ctx context.Context, links []*URLMapping, atomic bool) ([]error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errs := make([]error, len(links))
+	seen := make(map[string]bool, len(links))
+	failed := false
+	for i, m := range links {
+		if _, ok := s.links[m.ShortID]; ok || seen[m.ShortID] {
+			errs[i] = ErrDuplicate
+			failed = true
+		}
+		seen[m.ShortID] = true
+	}
+	if atomic && failed {
+		return errs, nil
+	}
+	for i, m := range links {
+		if errs[i] == nil {
+			s.links[m.ShortID] = *m
+		}
+	}
+	return errs, nil
+}
+
+func (s *MemoryLinkStore) Get(ctx context.Context, shortID string) (*URLMapping, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.links[shortID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &m, nil
+}
+
+func (s *MemoryLinkStore) Delete(ctx context.Context, shortID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.links[shortID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.links, shortID)
+	return nil
+}
+
+func (s *MemoryLinkStore) Update(ctx context.Context, m *URLMapping) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.links[m.ShortID]
+	if !ok {
+		return ErrNotFound
+	}
+	if cur.Version != m.Version {
+		return ErrConflict
+	}
+	updated := *m
+	updated.AccessCount = cur.AccessCount
+	updated.VariantClicks = cur.VariantClicks
+	updated.Version++
+	s.links[m.ShortID] = updated
+	m.Version = updated.Version
+	return nil
+}
+
+func (s *MemoryLinkStore) IncrementAccessCount(ctx context.Context, shortID string) (*URLMapping, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.links[shortID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if m.Exhausted() {
+		return nil, ErrExhausted
+	}
+	m.AccessCount++
+	s.links[shortID] = m
+	return &m, nil
+}
+
+func (s *MemoryLinkStore) IncrementVariantCount(ctx context.Context, shortID, variantID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.links[shortID]
+	if !ok {
+		return ErrNotFound
+	}
+	m.VariantClicks = incrementVariant(m.VariantClicks, variantID)
+	s.links[shortID] = m
+	return nil
+}
+
+// incrementVariant returns a copy of clicks with variantID counted once more,
+// leaving maps shared with earlier copies of the link untouched.
+func incrementVariant(clicks map[string]int, variantID string) map[string]int {
+	next := make(map[string]int, len(clicks)+1)
+	for id, n := range clicks {
+		next[id] = n
+	}
+	next[variantID]++
+	return next
+}
+
+func (s *MemoryLinkStore) List(ctx context.Context, opts ListOptions) ([]URLMapping, error) {
+	return selectLinks(s.snapshot(), opts), nil
+}
+
+func (s *MemoryLinkStore) Count(ctx context.Context, filter LinkFilter) (int64, error) {
+	return countLinks(s.snapshot(), filter), nil
+}
+
+func (s *MemoryLinkStore) FindReusable(ctx context.Context, owner, normalizedURL string) (*URLMapping, error) {
+	return findReusable(s.snapshot(), owner, normalizedURL)
+}
+
+func (s *MemoryLinkStore) snapshot() []URLMapping {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	links := make([]URLMapping, 0, len(s.links))
+	for _, m := range s.links {
+		links = append(links, m)
+	}
+	return links
+}
+
+func (s *MemoryLinkStore) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, m := range s.links {
+		if m.Expired(now) {
+			delete(s.links, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryLinkStore) NextSequence(ctx context.Context) (uint64, error) {
+	return s.seq.Add(1), nil
+}
+
+type memoryCacheEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// MemoryCache is an in-process Cache with per-key expiry.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]memoryCacheEntry)}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return "", ErrCacheMiss
+	}
+	if !e.expiresAt.IsZero() && time.Now().After(e.expiresAt) {
+		delete(c.entries, key)
+		return "", ErrCacheMiss
+	}
+	return e.value, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := memoryCacheEntry{value: value}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+	}
+	c.entries[key] = e
+	return nil
+}
+
+func (c *MemoryCache) SetMany(ctx context.Context, entries []CacheEntry) error {
+	for _, e := range entries {
+		_ = c.Set(ctx, e.Key, e.Value, e.TTL)
+	}
+	return nil
+}
+
+func (c *MemoryCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	return nil
+}
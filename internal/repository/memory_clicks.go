@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryClickStore keeps click events in process memory.
+type MemoryClickStore struct {
+	mu     sync.RWMutex
+	clicks map[string][]ClickEvent
+}
+
+func NewMemoryClickStore() *MemoryClickStore {
+	return &MemoryClickStore{clicks: make(map[string][]ClickEvent)}
+}
+
+func (s *MemoryClickStore) InsertClicks(ctx context.Context, events []ClickEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ev := range events {
+		s.clicks[ev.ShortID] = append(s.clicks[ev.ShortID], ev)
+	}
+	return nil
+}
+
+func (s *MemoryClickStore) ListClicks(ctx context.Context, shortID string, from, to time.Time) ([]ClickEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	results := []ClickEvent{}
+	for _, ev := range s.clicks[shortID] {
+		if !ev.Timestamp.Before(from) && ev.Timestamp.Before(to) {
+			results = append(results, ev)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Timestamp.Before(results[j].Timestamp) })
+	return results, nil
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryDomainStore keeps domain rules in process memory.
+type MemoryDomainStore struct {
+	mu    sync.RWMutex
+	rules map[string]DomainRule
+}
+
+func NewMemoryDomainStore() *MemoryDomainStore {
+	return &MemoryDomainStore{rules: make(map[string]DomainRule)}
+}
+
+func (s *MemoryDomainStore) PutDomainRule(ctx context.Context, rule *DomainRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules[rule.Domain] = *rule
+	return nil
+}
+
+func (s *MemoryDomainStore) DeleteDomainRule(ctx context.Context, domain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rules[domain]; !ok {
+		return ErrNotFound
+	}
+	delete(s.rules, domain)
+	return nil
+}
+
+func (s *MemoryDomainStore) ListDomainRules(ctx context.Context) ([]DomainRule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	results := make([]DomainRule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		results = append(results, rule)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Domain < results[j].Domain })
+	return results, nil
+}
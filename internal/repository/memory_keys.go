@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryKeyStore keeps API keys in process memory.
+type MemoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]APIKey
+}
+
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: make(map[string]APIKey)}
+}
+
+func (s *MemoryKeyStore) CreateKey(ctx context.Context, key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[key.ID]; ok {
+		return ErrDuplicate
+	}
+	s.keys[key.ID] = *key
+	return nil
+}
+
+func (s *MemoryKeyStore) GetKey(ctx context.Context, id string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &key, nil
+}
+
+func (s *MemoryKeyStore) ListKeys(ctx context.Context, owner string) ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	results := []APIKey{}
+	for _, key := range s.keys {
+		if owner == "" || key.Owner == owner {
+			results = append(results, key)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].CreatedAt.Before(results[j].CreatedAt) })
+	return results, nil
+}
+
+func (s *MemoryKeyStore) UpdateKey(ctx context.Context, key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[key.ID]; !ok {
+		return ErrNotFound
+	}
+	s.keys[key.ID] = *key
+	return nil
+}
+
+func (s *MemoryKeyStore) TouchKey(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	key.LastUsedAt = &at
+	s.keys[id] = key
+	return nil
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryUTMStore keeps owner UTM templates in process memory.
+type MemoryUTMStore struct {
+	mu        sync.RWMutex
+	templates map[string]OwnerUTM
+}
+
+func NewMemoryUTMStore() *MemoryUTMStore {
+	return &MemoryUTMStore{templates: make(map[string]OwnerUTM)}
+}
+
+func (s *MemoryUTMStore) PutOwnerUTM(ctx context.Context, t *OwnerUTM) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.templates[t.Owner] = *t
+	return nil
+}
+
+func (s *MemoryUTMStore) GetOwnerUTM(ctx context.Context, owner string) (*OwnerUTM, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.templates[owner]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &t, nil
+}
+
+func (s *MemoryUTMStore) DeleteOwnerUTM(ctx context.Context, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.templates[owner]; !ok {
+		return ErrNotFound
+	}
+	delete(s.templates, owner)
+	return nil
+}
+
+func (s *MemoryUTMStore) ListOwnerUTM(ctx context.Context) ([]OwnerUTM, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	results := make([]OwnerUTM, 0, len(s.templates))
+	for _, t := range s.templates {
+		results = append(results, t)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Owner < results[j].Owner })
+	return results, nil
+}
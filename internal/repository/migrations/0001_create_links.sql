@@ -0,0 +1,10 @@
+CREATE TABLE links (
+    id           BIGSERIAL PRIMARY KEY,
+    short_id     TEXT        NOT NULL,
+    long_url     TEXT        NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    access_count BIGINT      NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX links_short_id_key ON links (short_id);
+CREATE INDEX links_created_at_idx ON links (created_at DESC);
@@ -0,0 +1 @@
+CREATE SEQUENCE short_id_seq AS BIGINT START WITH 1;
@@ -0,0 +1,3 @@
+ALTER TABLE links ADD COLUMN expires_at TIMESTAMPTZ;
+
+CREATE INDEX links_expires_at_idx ON links (expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE links
+    ADD COLUMN version INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN doc     JSONB   NOT NULL DEFAULT '{}'::jsonb;
@@ -0,0 +1,11 @@
+CREATE TABLE clicks (
+    id              BIGSERIAL PRIMARY KEY,
+    short_id        TEXT        NOT NULL,
+    occurred_at     TIMESTAMPTZ NOT NULL,
+    referrer        TEXT        NOT NULL DEFAULT '',
+    user_agent      TEXT        NOT NULL DEFAULT '',
+    ip_hash         TEXT        NOT NULL DEFAULT '',
+    accept_language TEXT        NOT NULL DEFAULT ''
+);
+
+CREATE INDEX clicks_short_id_occurred_at_idx ON clicks (short_id, occurred_at);
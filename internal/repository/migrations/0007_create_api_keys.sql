@@ -0,0 +1,14 @@
+CREATE TABLE api_keys (
+    id           TEXT PRIMARY KEY,
+    owner        TEXT        NOT NULL,
+    name         TEXT        NOT NULL DEFAULT '',
+    hash         TEXT        NOT NULL,
+    scopes       TEXT        NOT NULL DEFAULT '',
+    admin        BOOLEAN     NOT NULL DEFAULT FALSE,
+    created_at   TIMESTAMPTZ NOT NULL,
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
+
+CREATE INDEX api_keys_owner_created_at_idx ON api_keys (owner, created_at);
@@ -0,0 +1,13 @@
+ALTER TABLE links ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE links ADD COLUMN domain TEXT NOT NULL DEFAULT '';
+
+UPDATE links SET
+    owner = COALESCE(doc->>'owner', ''),
+    domain = lower(COALESCE(substring(long_url from '^[^:]+://(?:[^@/?#]*@)?([^/?#:]+)'), ''));
+
+CREATE INDEX links_created_at_short_id_idx ON links (created_at, short_id);
+CREATE INDEX links_access_count_short_id_idx ON links (access_count, short_id);
+CREATE INDEX links_owner_created_at_idx ON links (owner, created_at, short_id);
+CREATE INDEX links_owner_access_count_idx ON links (owner, access_count, short_id);
+CREATE INDEX links_domain_idx ON links (domain);
+CREATE INDEX links_tags_idx ON links USING GIN ((doc->'tags'));
@@ -0,0 +1,3 @@
+ALTER TABLE links ADD COLUMN normalized_url TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX links_owner_normalized_url_idx ON links (owner, normalized_url, created_at);
@@ -0,0 +1,6 @@
+CREATE TABLE domain_rules (
+    domain     TEXT PRIMARY KEY,
+    action     TEXT        NOT NULL,
+    reason     TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
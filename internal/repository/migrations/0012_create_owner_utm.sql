@@ -0,0 +1,5 @@
+CREATE TABLE owner_utm (
+    owner      TEXT PRIMARY KEY,
+    utm        JSONB       NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
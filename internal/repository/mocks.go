@@ -5,107 +5,81 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/mock"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// ===== REDIS MOCKS =====
+// ===== LINK STORE MOCK =====
 
-type MockStatusCmd struct {
+type MockLinkStore struct {
 	mock.Mock
-	err error
 }
 
-func (m *MockStatusCmd) Err() error {
-	return m.err
+func (m *MockLinkStore) Create(ctx context.Context, mapping *URLMapping) error {
+	args := m.Called(ctx, mapping)
+	return args.Error(0)
 }
 
-type MockStringCmd struct {
-	mock.Mock
-	val string
-	err error
-}
-
-func (m *MockStringCmd) Result() (string, error) {
-	return m.val, m.err
+func (m *MockLinkStore) Get(ctx context.Context, shortID string) (*URLMapping, error) {
+	args := m.Called(ctx, shortID)
+	mapping, _ := args.Get(0).(*URLMapping)
+	return mapping, args.Error(1)
 }
 
-type MockIntCmd struct {
-	mock.Mock
-	val int64
-	err error
+func (m *MockLinkStore) Delete(ctx context.Context, shortID string) error {
+	args := m.Called(ctx, shortID)
+	return args.Error(0)
 }
 
-func (m *MockIntCmd) Result() (int64, error) {
-	return m.val, m.err
+func (m *MockLinkStore) Update(ctx context.Context, mapping *URLMapping) error {
+	args := m.Called(ctx, mapping)
+	return args.Error(0)
 }
 
-type MockRedisClient struct {
-	mock.Mock
+func (m *MockLinkStore) IncrementAccessCount(ctx context.Context, shortID string) (*URLMapping, error) {
+	args := m.Called(ctx, shortID)
+	mapping, _ := args.Get(0).(*URLMapping)
+	return mapping, args.Error(1)
 }
 
-func (m *MockRedisClient) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *MockStatusCmd {
-	args := m.Called(ctx, key, value, expiration)
-	return args.Get(0).(*MockStatusCmd)
+func (m *MockLinkStore) IncrementVariantCount(ctx context.Context, shortID, variantID string) error {
+	args := m.Called(ctx, shortID, variantID)
+	return args.Error(0)
 }
 
-func (m *MockRedisClient) Get(ctx context.Context, key string) *MockStringCmd {
-	args := m.Called(ctx, key)
-	return args.Get(0).(*MockStringCmd)
+func (m *MockLinkStore) List(ctx context.Context, opts ListOptions) ([]URLMapping, error) {
+	args := m.Called(ctx, opts)
+	mappings, _ := args.Get(0).([]URLMapping)
+	return mappings, args.Error(1)
 }
 
-func (m *MockRedisClient) Del(ctx context.Context, keys ...string) *MockIntCmd {
-	args := m.Called(ctx, keys)
-	return args.Get(0).(*MockIntCmd)
-}
-
-// ===== MONGO MOCKS =====
-
-type MockMongoCollection struct {
-	mock.Mock
-}
-
-func (m *MockMongoCollection) InsertOne(ctx context.Context, document interface{},
-	opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
-	args := m.Called(ctx, document)
-	return args.Get(0).(*mongo.InsertOneResult), args.Error(1)
-}
-
-func (m *MockMongoCollection) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{},
-	opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
-	args := m.Called(ctx, filter, update)
-	return args.Get(0).(*mongo.SingleResult)
-}
-
-func (m *MockMongoCollection) FindOne(ctx context.Context, filter interface{}) *mongo.SingleResult {
+func (m *MockLinkStore) Count(ctx context.Context, filter LinkFilter) (int64, error) {
 	args := m.Called(ctx, filter)
-	return args.Get(0).(*mongo.SingleResult)
+	n, _ := args.Get(0).(int64)
+	return n, args.Error(1)
 }
 
-func (m *MockMongoCollection) DeleteOne(ctx context.Context, filter interface{},
-	opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
-	args := m.Called(ctx, filter)
-	return args.Get(0).(*mongo.DeleteResult), args.Error(1)
+func (m *MockLinkStore) FindReusable(ctx context.Context, owner, normalizedURL string) (*URLMapping, error) {
+	args := m.Called(ctx, owner, normalizedURL)
+	mapping, _ := args.Get(0).(*URLMapping)
+	return mapping, args.Error(1)
 }
 
-type MockMongoClient struct {
-	db map[string]*MockMongoCollection
-}
+// ===== CACHE MOCK =====
 
-func NewMockMongoClient(col *MockMongoCollection) *MockMongoClient {
-	return &MockMongoClient{
-		db: map[string]*MockMongoCollection{"urls": col},
-	}
+type MockCache struct {
+	mock.Mock
 }
 
-func (m *MockMongoClient) Database(name string, opts ...*options.DatabaseOptions) *MockMongoDatabase {
-	return &MockMongoDatabase{colls: m.db}
+func (m *MockCache) Get(ctx context.Context, key string) (string, error) {
+	args := m.Called(ctx, key)
+	return args.String(0), args.Error(1)
 }
 
-type MockMongoDatabase struct {
-	colls map[string]*MockMongoCollection
+func (m *MockCache) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	args := m.Called(ctx, key, value, ttl)
+	return args.Error(0)
 }
 
-func (db *MockMongoDatabase) Collection(name string, opts ...*options.CollectionOptions) *MockMongoCollection {
-	return db.colls[name]
+func (m *MockCache) Delete(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
 }
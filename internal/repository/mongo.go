@@ -0,0 +1,436 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func NewMongoClient(ctx context.Context, uri string) (*mongo.Client, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		return nil, fmt.Errorf("MongoDB ping failed: %w", err)
+	}
+	log.Println("✅ Connected to MongoDB")
+	return client, nil
+}
+
+// MongoLinkStore keeps links in the "urls" collection of the given database.
+type MongoLinkStore struct {
+	urls     *mongo.Collection
+	counters *mongo.Collection
+
+	mu           sync.Mutex // guards transactions
+	transactions *bool
+}
+
+func NewMongoLinkStore(db *mongo.Database) *MongoLinkStore {
+	return &MongoLinkStore{
+		urls:     db.Collection("urls"),
+		counters: db.Collection("counters"),
+	}
+}
+
+// EnsureIndexes creates the indexes the store relies on. The unique index on
+// short_id is what turns a taken alias into ErrDuplicate, the TTL index on
+// expires_at lets Mongo purge expired links on its own, and the rest back the
+// filters and sort orders of List.
+func (s *MongoLinkStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.urls.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "short_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "short_id", Value: -1}}},
+		{Keys: bson.D{{Key: "access_count", Value: -1}, {Key: "short_id", Value: -1}}},
+		{Keys: bson.D{{Key: "owner", Value: 1}, {Key: "created_at", Value: -1}, {Key: "short_id", Value: -1}}},
+		{Keys: bson.D{{Key: "owner", Value: 1}, {Key: "access_count", Value: -1}, {Key: "short_id", Value: -1}}},
+		{Keys: bson.D{{Key: "tags", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}}},
+		{Keys: bson.D{{Key: "owner", Value: 1}, {Key: "normalized_url", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create MongoDB indexes: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoLinkStore) Create(ctx context.Context, m *URLMapping) error {
+	start := time.Now()
+	_, err := s.urls.InsertOne(ctx, m)
+	metrics.MongoOpDuration.WithLabelValues("InsertOne").Observe(time.Since(start).Seconds())
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// CreateMany inserts links with a single unordered InsertMany. Atomic batches
+// run in a transaction, which Mongo only supports on replica sets and sharded
+// clusters; a standalone server rejects them with ErrAtomicUnsupported.
+func (s *MongoLinkStore) CreateMany(ctx context.Context, links []*URLMapping, atomic bool) ([]error, error) {
+	if !atomic {
+		return s.insertMany(ctx, links)
+	}
+	supported, err := s.supportsTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !supported {
+		return nil, ErrAtomicUnsupported
+	}
+
+	session, err := s.urls.Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+	var errs []error
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		var err error
+		if errs, err = s.insertMany(sc, links); err != nil {
+			return nil, err
+		}
+		for _, e := range errs {
+			if e != nil {
+				// Aborts the transaction; errs reports why.
+				return nil, errBatchFailed
+			}
+		}
+		return nil, nil
+	})
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		return nil, err
+	}
+	return errs, nil
+}
+
+var errBatchFailed = errors.New("batch item failed")
+
+// insertMany inserts links and maps the write errors to their items.
+func (s *MongoLinkStore) insertMany(ctx context.Context, links []*URLMapping) ([]error, error) {
+	docs := make([]interface{}, len(links))
+	for i, m := range links {
+		docs[i] = m
+	}
+	errs := make([]error, len(links))
+	start := time.Now()
+	_, err := s.urls.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	metrics.MongoOpDuration.WithLabelValues("InsertMany").Observe(time.Since(start).Seconds())
+	if err != nil {
+		var bwe mongo.BulkWriteException
+		if !errors.As(err, &bwe) || bwe.WriteConcernError != nil {
+			return nil, err
+		}
+		for _, we := range bwe.WriteErrors {
+			if we.Code == 11000 {
+				errs[we.Index] = ErrDuplicate
+			} else {
+				errs[we.Index] = errors.New(we.Message)
+			}
+		}
+	}
+	return errs, nil
+}
+
+// supportsTransactions asks the server, once, whether it is a replica set
+// member or a mongos.
+func (s *MongoLinkStore) supportsTransactions(ctx context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transactions != nil {
+		return *s.transactions, nil
+	}
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	start := time.Now()
+	err := s.urls.Database().RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	metrics.MongoOpDuration.WithLabelValues("Hello").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return false, fmt.Errorf("failed to query MongoDB topology: %w", err)
+	}
+	supported := hello.SetName != "" || hello.Msg == "isdbgrid"
+	s.transactions = &supported
+	return supported, nil
+}
+
+func (s *MongoLinkStore) Get(ctx context.Context, shortID string) (*URLMapping, error) {
+	var result URLMapping
+	start := time.Now()
+	err := s.urls.FindOne(ctx, bson.M{"short_id": shortID}).Decode(&result)
+	metrics.MongoOpDuration.WithLabelValues("FindOne").Observe(time.Since(start).Seconds())
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *MongoLinkStore) Delete(ctx context.Context, shortID string) error {
+	start := time.Now()
+	res, err := s.urls.DeleteOne(ctx, bson.M{"short_id": shortID})
+	metrics.MongoOpDuration.WithLabelValues("DeleteOne").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoLinkStore) Update(ctx context.Context, m *URLMapping) error {
+	raw, err := bson.Marshal(m)
+	if err != nil {
+		return err
+	}
+	var fields bson.M
+	if err := bson.Unmarshal(raw, &fields); err != nil {
+		return err
+	}
+	// access_count and variant_clicks are owned by the increments and never
+	// overwritten here.
+	delete(fields, "access_count")
+	delete(fields, "variant_clicks")
+	fields["version"] = m.Version + 1
+	update := bson.M{"$set": fields}
+	if unset := omittedFields(fields); len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	// Documents written before versioning have no version field.
+	versionFilter := any(m.Version)
+	if m.Version == 0 {
+		versionFilter = bson.M{"$in": bson.A{0, nil}}
+	}
+	start := time.Now()
+	res, err := s.urls.UpdateOne(ctx, bson.M{"short_id": m.ShortID, "version": versionFilter}, update)
+	metrics.MongoOpDuration.WithLabelValues("UpdateOne").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		if _, err := s.Get(ctx, m.ShortID); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+	m.Version++
+	return nil
+}
+
+// omittedFields lists the omitempty fields of URLMapping missing from fields,
+// so that clearing a setting removes it from the stored document too.
+func omittedFields(fields bson.M) bson.M {
+	unset := bson.M{}
+	t := reflect.TypeOf(URLMapping{})
+	for i := 0; i < t.NumField(); i++ {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("bson"), ",")
+		if !strings.Contains(opts, "omitempty") {
+			continue
+		}
+		if _, ok := fields[name]; !ok {
+			unset[name] = ""
+		}
+	}
+	delete(unset, "variant_clicks")
+	return unset
+}
+
+func (s *MongoLinkStore) IncrementAccessCount(ctx context.Context, shortID string) (*URLMapping, error) {
+	var result URLMapping
+	start := time.Now()
+	err := s.urls.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"short_id": shortID,
+			"$or": bson.A{
+				bson.M{"max_clicks": bson.M{"$exists": false}},
+				bson.M{"max_clicks": 0},
+				bson.M{"$expr": bson.M{"$lt": bson.A{"$access_count", "$max_clicks"}}},
+			},
+		},
+		bson.M{"$inc": bson.M{"access_count": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&result)
+	metrics.MongoOpDuration.WithLabelValues("FindOneAndUpdate").Observe(time.Since(start).Seconds())
+	if err == mongo.ErrNoDocuments {
+		// Either the link does not exist or its click limit filtered it out.
+		if _, getErr := s.Get(ctx, shortID); getErr != nil {
+			return nil, getErr
+		}
+		return nil, ErrExhausted
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *MongoLinkStore) IncrementVariantCount(ctx context.Context, shortID, variantID string) error {
+	start := time.Now()
+	res, err := s.urls.UpdateOne(ctx,
+		bson.M{"short_id": shortID},
+		bson.M{"$inc": bson.M{"variant_clicks." + variantID: 1}},
+	)
+	metrics.MongoOpDuration.WithLabelValues("UpdateOne").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoLinkStore) FindReusable(ctx context.Context, owner, normalizedURL string) (*URLMapping, error) {
+	var result URLMapping
+	start := time.Now()
+	err := s.urls.FindOne(ctx,
+		bson.M{
+			"owner":          owner,
+			"normalized_url": normalizedURL,
+			// Only Reusable links; the option fields are omitted when unset.
+			"expires_at":        bson.M{"$exists": false},
+			"max_clicks":        bson.M{"$exists": false},
+			"redirect_type":     bson.M{"$exists": false},
+			"interstitial":      bson.M{"$exists": false},
+			"stats_private":     bson.M{"$exists": false},
+			"password_hash":     bson.M{"$exists": false},
+			"rules":             bson.M{"$exists": false},
+			"variants":          bson.M{"$exists": false},
+			"utm":               bson.M{"$exists": false},
+			"query_passthrough": bson.M{"$exists": false},
+		},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	).Decode(&result)
+	metrics.MongoOpDuration.WithLabelValues("FindOne").Observe(time.Since(start).Seconds())
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// mongoFilter translates f into a query on the "urls" collection. Links
+// stored before the domain field existed are matched on their long_url.
+func mongoFilter(f LinkFilter) bson.M {
+	filter := bson.M{}
+	var and bson.A
+	if f.Owner != "" {
+		filter["owner"] = f.Owner
+	}
+	created := bson.M{}
+	if f.CreatedFrom != nil {
+		created["$gte"] = *f.CreatedFrom
+	}
+	if f.CreatedTo != nil {
+		created["$lt"] = *f.CreatedTo
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+	if f.Tag != "" {
+		filter["tags"] = f.Tag
+	}
+	if f.Domain != "" {
+		pattern := regexp.QuoteMeta(strings.ToLower(f.Domain))
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"domain": primitive.Regex{Pattern: pattern}},
+			bson.M{"domain": bson.M{"$exists": false}, "long_url": primitive.Regex{Pattern: `^[^:]+://[^/?#]*` + pattern, Options: "i"}},
+		}})
+	}
+	if len(and) > 0 {
+		filter["$and"] = and
+	}
+	return filter
+}
+
+func (s *MongoLinkStore) List(ctx context.Context, opts ListOptions) ([]URLMapping, error) {
+	field, dir, op := SortCreatedAt, -1, "$lt"
+	if opts.Sort == SortAccessCount {
+		field = SortAccessCount
+	}
+	if opts.Asc {
+		dir, op = 1, "$gt"
+	}
+
+	filter := mongoFilter(opts.Filter)
+	if opts.After != nil {
+		var value any = opts.After.Created
+		if field == SortAccessCount {
+			value = opts.After.AccessCount
+		}
+		and, _ := filter["$and"].(bson.A)
+		filter["$and"] = append(and, bson.M{"$or": bson.A{
+			bson.M{field: bson.M{op: value}},
+			bson.M{field: value, "short_id": bson.M{op: opts.After.ShortID}},
+		}})
+	}
+
+	findOpts := options.Find().SetSort(bson.D{{Key: field, Value: dir}, {Key: "short_id", Value: dir}})
+	if opts.Limit > 0 {
+		findOpts.SetLimit(int64(opts.Limit))
+	}
+	start := time.Now()
+	cur, err := s.urls.Find(ctx, filter, findOpts)
+	metrics.MongoOpDuration.WithLabelValues("Find").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, err
+	}
+	results := []URLMapping{}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *MongoLinkStore) Count(ctx context.Context, filter LinkFilter) (int64, error) {
+	start := time.Now()
+	n, err := s.urls.CountDocuments(ctx, mongoFilter(filter))
+	metrics.MongoOpDuration.WithLabelValues("CountDocuments").Observe(time.Since(start).Seconds())
+	return n, err
+}
+
+func (s *MongoLinkStore) NextSequence(ctx context.Context) (uint64, error) {
+	var result struct {
+		Seq int64 `bson:"seq"`
+	}
+	start := time.Now()
+	err := s.counters.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": "short_id"},
+		bson.M{"$inc": bson.M{"seq": int64(1)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&result)
+	metrics.MongoOpDuration.WithLabelValues("FindOneAndUpdate").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return uint64(result.Seq), nil
+}
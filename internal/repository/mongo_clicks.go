@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoClickStore keeps click events in the "clicks" collection.
+type MongoClickStore struct {
+	clicks *mongo.Collection
+}
+
+func NewMongoClickStore(db *mongo.Database) *MongoClickStore {
+	return &MongoClickStore{clicks: db.Collection("clicks")}
+}
+
+func (s *MongoClickStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.clicks.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "short_id", Value: 1}, {Key: "timestamp", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create MongoDB indexes: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoClickStore) InsertClicks(ctx context.Context, events []ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(events))
+	for i := range events {
+		docs[i] = events[i]
+	}
+	start := time.Now()
+	_, err := s.clicks.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	metrics.MongoOpDuration.WithLabelValues("InsertMany").Observe(time.Since(start).Seconds())
+	return err
+}
+
+func (s *MongoClickStore) ListClicks(ctx context.Context, shortID string, from, to time.Time) ([]ClickEvent, error) {
+	start := time.Now()
+	cur, err := s.clicks.Find(ctx,
+		bson.M{"short_id": shortID, "timestamp": bson.M{"$gte": from, "$lt": to}},
+		options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}),
+	)
+	metrics.MongoOpDuration.WithLabelValues("Find").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, err
+	}
+	results := []ClickEvent{}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoDomainStore keeps domain rules in the "domain_rules" collection.
+type MongoDomainStore struct {
+	rules *mongo.Collection
+}
+
+func NewMongoDomainStore(db *mongo.Database) *MongoDomainStore {
+	return &MongoDomainStore{rules: db.Collection("domain_rules")}
+}
+
+func (s *MongoDomainStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.rules.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "domain", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create MongoDB indexes: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoDomainStore) PutDomainRule(ctx context.Context, rule *DomainRule) error {
+	start := time.Now()
+	_, err := s.rules.ReplaceOne(ctx, bson.M{"domain": rule.Domain}, rule, options.Replace().SetUpsert(true))
+	metrics.MongoOpDuration.WithLabelValues("ReplaceOne").Observe(time.Since(start).Seconds())
+	return err
+}
+
+func (s *MongoDomainStore) DeleteDomainRule(ctx context.Context, domain string) error {
+	start := time.Now()
+	res, err := s.rules.DeleteOne(ctx, bson.M{"domain": domain})
+	metrics.MongoOpDuration.WithLabelValues("DeleteOne").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoDomainStore) ListDomainRules(ctx context.Context) ([]DomainRule, error) {
+	start := time.Now()
+	cur, err := s.rules.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "domain", Value: 1}}))
+	metrics.MongoOpDuration.WithLabelValues("Find").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, err
+	}
+	results := []DomainRule{}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoKeyStore keeps API keys in the "api_keys" collection.
+type MongoKeyStore struct {
+	keys *mongo.Collection
+}
+
+func NewMongoKeyStore(db *mongo.Database) *MongoKeyStore {
+	return &MongoKeyStore{keys: db.Collection("api_keys")}
+}
+
+func (s *MongoKeyStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.keys.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "owner", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create MongoDB indexes: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoKeyStore) CreateKey(ctx context.Context, key *APIKey) error {
+	start := time.Now()
+	_, err := s.keys.InsertOne(ctx, key)
+	metrics.MongoOpDuration.WithLabelValues("InsertOne").Observe(time.Since(start).Seconds())
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (s *MongoKeyStore) GetKey(ctx context.Context, id string) (*APIKey, error) {
+	var key APIKey
+	start := time.Now()
+	err := s.keys.FindOne(ctx, bson.M{"key_id": id}).Decode(&key)
+	metrics.MongoOpDuration.WithLabelValues("FindOne").Observe(time.Since(start).Seconds())
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *MongoKeyStore) ListKeys(ctx context.Context, owner string) ([]APIKey, error) {
+	filter := bson.M{}
+	if owner != "" {
+		filter["owner"] = owner
+	}
+	start := time.Now()
+	cur, err := s.keys.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	metrics.MongoOpDuration.WithLabelValues("Find").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, err
+	}
+	results := []APIKey{}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *MongoKeyStore) UpdateKey(ctx context.Context, key *APIKey) error {
+	start := time.Now()
+	res, err := s.keys.ReplaceOne(ctx, bson.M{"key_id": key.ID}, key)
+	metrics.MongoOpDuration.WithLabelValues("ReplaceOne").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoKeyStore) TouchKey(ctx context.Context, id string, at time.Time) error {
+	start := time.Now()
+	res, err := s.keys.UpdateOne(ctx, bson.M{"key_id": id}, bson.M{"$set": bson.M{"last_used_at": at}})
+	metrics.MongoOpDuration.WithLabelValues("UpdateOne").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
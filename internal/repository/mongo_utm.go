@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoUTMStore keeps owner UTM templates in the "owner_utm" collection.
+type MongoUTMStore struct {
+	templates *mongo.Collection
+}
+
+func NewMongoUTMStore(db *mongo.Database) *MongoUTMStore {
+	return &MongoUTMStore{templates: db.Collection("owner_utm")}
+}
+
+func (s *MongoUTMStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.templates.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "owner", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create MongoDB indexes: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoUTMStore) PutOwnerUTM(ctx context.Context, t *OwnerUTM) error {
+	start := time.Now()
+	_, err := s.templates.ReplaceOne(ctx, bson.M{"owner": t.Owner}, t, options.Replace().SetUpsert(true))
+	metrics.MongoOpDuration.WithLabelValues("ReplaceOne").Observe(time.Since(start).Seconds())
+	return err
+}
+
+func (s *MongoUTMStore) GetOwnerUTM(ctx context.Context, owner string) (*OwnerUTM, error) {
+	var t OwnerUTM
+	start := time.Now()
+	err := s.templates.FindOne(ctx, bson.M{"owner": owner}).Decode(&t)
+	metrics.MongoOpDuration.WithLabelValues("FindOne").Observe(time.Since(start).Seconds())
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *MongoUTMStore) DeleteOwnerUTM(ctx context.Context, owner string) error {
+	start := time.Now()
+	res, err := s.templates.DeleteOne(ctx, bson.M{"owner": owner})
+	metrics.MongoOpDuration.WithLabelValues("DeleteOne").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoUTMStore) ListOwnerUTM(ctx context.Context) ([]OwnerUTM, error) {
+	start := time.Now()
+	cur, err := s.templates.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "owner", Value: 1}}))
+	metrics.MongoOpDuration.WithLabelValues("Find").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, err
+	}
+	results := []OwnerUTM{}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,392 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+)
+
+func NewPostgresDB(ctx context.Context, dsn string) (*sql.DB, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PostgreSQL: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("PostgreSQL ping failed: %w", err)
+	}
+	log.Println("✅ Connected to PostgreSQL")
+	return db, nil
+}
+
+// PostgresLinkStore keeps links in the "links" table created by Migrate.
+type PostgresLinkStore struct {
+	db *sql.DB
+}
+
+func NewPostgresLinkStore(db *sql.DB) *PostgresLinkStore {
+	return &PostgresLinkStore{db: db}
+}
+
+// Fields that are queried or updated atomically live in their own columns;
+// everything else travels in the doc JSONB column, which always holds the
+// full mapping as of the last Create or Update. The variant counters are the
+// exception: they live in doc but only IncrementVariantCount changes them.
+const linkColumns = `short_id, long_url, created_at, access_count, expires_at, max_clicks, version, doc`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanLink(row rowScanner) (*URLMapping, error) {
+	var m URLMapping
+	var expiresAt sql.NullTime
+	var maxClicks sql.NullInt64
+	var doc []byte
+	var shortID, longURL string
+	var created time.Time
+	var accessCount, version int
+	if err := row.Scan(&shortID, &longURL, &created, &accessCount, &expiresAt, &maxClicks, &version, &doc); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if len(doc) > 0 {
+		if err := json.Unmarshal(doc, &m); err != nil {
+			return nil, fmt.Errorf("failed to decode link %s: %w", shortID, err)
+		}
+	}
+	m.ShortID, m.LongURL, m.Created = shortID, longURL, created
+	m.AccessCount, m.Version = accessCount, version
+	m.ExpiresAt = nil
+	if expiresAt.Valid {
+		m.ExpiresAt = &expiresAt.Time
+	}
+	m.MaxClicks = int(maxClicks.Int64)
+	return &m, nil
+}
+
+func nullMaxClicks(m *URLMapping) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(m.MaxClicks), Valid: m.MaxClicks > 0}
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func observePostgres(op string, start time.Time) {
+	metrics.PostgresOpDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+func (s *PostgresLinkStore) Create(ctx context.Context, m *URLMapping) error {
+	defer observePostgres("Insert", time.Now())
+	doc, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO links (short_id, long_url, created_at, access_count, expires_at, max_clicks, version, doc, owner, domain, normalized_url)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		m.ShortID, m.LongURL, m.Created, m.AccessCount, m.ExpiresAt, nullMaxClicks(m), m.Version, doc, m.Owner, linkDomain(m), m.NormalizedURL,
+	)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// CreateMany inserts links with one multi-row INSERT inside a transaction.
+// Taken short IDs are skipped by ON CONFLICT and reported as ErrDuplicate;
+// an atomic batch with any duplicate is rolled back.
+func (s *PostgresLinkStore) CreateMany(ctx context.Context, links []*URLMapping, atomic bool) ([]error, error) {
+	if len(links) == 0 {
+		return nil, nil
+	}
+	defer observePostgres("InsertMany", time.Now())
+	const perRow = 11
+	placeholders := make([]string, len(links))
+	args := make([]any, 0, len(links)*perRow)
+	for i, m := range links {
+		doc, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		row := make([]string, perRow)
+		for k := range row {
+			row[k] = fmt.Sprintf("$%d", i*perRow+k+1)
+		}
+		placeholders[i] = "(" + strings.Join(row, ", ") + ")"
+		args = append(args, m.ShortID, m.LongURL, m.Created, m.AccessCount, m.ExpiresAt, nullMaxClicks(m),
+			m.Version, doc, m.Owner, linkDomain(m), m.NormalizedURL)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx,
+		`INSERT INTO links (short_id, long_url, created_at, access_count, expires_at, max_clicks, version, doc, owner, domain, normalized_url)
+		VALUES `+strings.Join(placeholders, ", ")+`
+		ON CONFLICT (short_id) DO NOTHING
+		RETURNING short_id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	inserted := make(map[string]bool, len(links))
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		inserted[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(links))
+	failed := false
+	for i, m := range links {
+		// A short ID repeated within the batch is only inserted once.
+		if !inserted[m.ShortID] {
+			errs[i] = ErrDuplicate
+			failed = true
+		}
+		delete(inserted, m.ShortID)
+	}
+	if atomic && failed {
+		return errs, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+func (s *PostgresLinkStore) Get(ctx context.Context, shortID string) (*URLMapping, error) {
+	defer observePostgres("Select", time.Now())
+	row := s.db.QueryRowContext(ctx, `SELECT `+linkColumns+` FROM links WHERE short_id = $1`, shortID)
+	return scanLink(row)
+}
+
+func (s *PostgresLinkStore) Delete(ctx context.Context, shortID string) error {
+	defer observePostgres("Delete", time.Now())
+	res, err := s.db.ExecContext(ctx, `DELETE FROM links WHERE short_id = $1`, shortID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresLinkStore) Update(ctx context.Context, m *URLMapping) error {
+	defer observePostgres("Update", time.Now())
+	next := *m
+	next.Version++
+	doc, err := json.Marshal(&next)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE links SET long_url = $1, expires_at = $2, max_clicks = $3,
+		doc = ($4::jsonb - 'variant_clicks') || jsonb_strip_nulls(jsonb_build_object('variant_clicks', doc->'variant_clicks')),
+		domain = $5, normalized_url = $6, version = version + 1
+		WHERE short_id = $7 AND version = $8`,
+		m.LongURL, m.ExpiresAt, nullMaxClicks(m), doc, linkDomain(m), m.NormalizedURL, m.ShortID, m.Version,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := s.Get(ctx, m.ShortID); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+	m.Version = next.Version
+	return nil
+}
+
+func (s *PostgresLinkStore) IncrementAccessCount(ctx context.Context, shortID string) (*URLMapping, error) {
+	defer observePostgres("Increment", time.Now())
+	row := s.db.QueryRowContext(ctx,
+		`UPDATE links SET access_count = access_count + 1
+		WHERE short_id = $1 AND (max_clicks IS NULL OR access_count < max_clicks)
+		RETURNING `+linkColumns,
+		shortID,
+	)
+	m, err := scanLink(row)
+	if errors.Is(err, ErrNotFound) {
+		// Either the link does not exist or its click limit filtered it out.
+		if _, getErr := s.Get(ctx, shortID); getErr != nil {
+			return nil, getErr
+		}
+		return nil, ErrExhausted
+	}
+	return m, err
+}
+
+func (s *PostgresLinkStore) IncrementVariantCount(ctx context.Context, shortID, variantID string) error {
+	defer observePostgres("IncrementVariant", time.Now())
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE links SET doc = jsonb_set(doc, '{variant_clicks}',
+			COALESCE(doc->'variant_clicks', '{}'::jsonb) || jsonb_build_object($2::text, COALESCE((doc->'variant_clicks'->>$2)::int, 0) + 1))
+		WHERE short_id = $1`,
+		shortID, variantID,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresLinkStore) FindReusable(ctx context.Context, owner, normalizedURL string) (*URLMapping, error) {
+	defer observePostgres("FindReusable", time.Now())
+	// The options of a Reusable link are all omitted from doc.
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+linkColumns+` FROM links
+		WHERE owner = $1 AND normalized_url = $2
+		AND expires_at IS NULL AND max_clicks IS NULL
+		AND NOT doc ?| array['password_hash', 'rules', 'variants', 'utm', 'query_passthrough',
+			'redirect_type', 'interstitial', 'stats_private']
+		ORDER BY created_at DESC LIMIT 1`,
+		owner, normalizedURL,
+	)
+	return scanLink(row)
+}
+
+// postgresWhere translates f into a WHERE clause, numbering its
+// placeholders after the ones already in args.
+func postgresWhere(f LinkFilter, args []any) (string, []any) {
+	var conds []string
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.Owner != "" {
+		add("owner = $%d", f.Owner)
+	}
+	if f.CreatedFrom != nil {
+		add("created_at >= $%d", *f.CreatedFrom)
+	}
+	if f.CreatedTo != nil {
+		add("created_at < $%d", *f.CreatedTo)
+	}
+	if f.Tag != "" {
+		add("doc->'tags' ? $%d", f.Tag)
+	}
+	if f.Domain != "" {
+		add("strpos(domain, $%d) > 0", strings.ToLower(f.Domain))
+	}
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+func (s *PostgresLinkStore) List(ctx context.Context, opts ListOptions) ([]URLMapping, error) {
+	defer observePostgres("List", time.Now())
+	column, dir, op := SortCreatedAt, "DESC", "<"
+	if opts.Sort == SortAccessCount {
+		column = SortAccessCount
+	}
+	if opts.Asc {
+		dir, op = "ASC", ">"
+	}
+
+	where, args := postgresWhere(opts.Filter, nil)
+	if opts.After != nil {
+		var value any = opts.After.Created
+		if column == SortAccessCount {
+			value = opts.After.AccessCount
+		}
+		args = append(args, value, opts.After.ShortID)
+		keyset := fmt.Sprintf("(%s, short_id) %s ($%d, $%d)", column, op, len(args)-1, len(args))
+		if where == "" {
+			where = " WHERE " + keyset
+		} else {
+			where += " AND " + keyset
+		}
+	}
+	args = append(args, sql.NullInt64{Int64: int64(opts.Limit), Valid: opts.Limit > 0})
+
+	rows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf(`SELECT %s FROM links%s ORDER BY %s %s, short_id %s LIMIT $%d`,
+			linkColumns, where, column, dir, dir, len(args)),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []URLMapping{}
+	for rows.Next() {
+		m, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *m)
+	}
+	return results, rows.Err()
+}
+
+func (s *PostgresLinkStore) Count(ctx context.Context, filter LinkFilter) (int64, error) {
+	defer observePostgres("Count", time.Now())
+	where, args := postgresWhere(filter, nil)
+	var n int64
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM links`+where, args...).Scan(&n)
+	return n, err
+}
+
+func (s *PostgresLinkStore) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	defer observePostgres("DeleteExpired", time.Now())
+	res, err := s.db.ExecContext(ctx, `DELETE FROM links WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *PostgresLinkStore) NextSequence(ctx context.Context) (uint64, error) {
+	defer observePostgres("NextSequence", time.Now())
+	var n int64
+	if err := s.db.QueryRowContext(ctx, `SELECT nextval('short_id_seq')`).Scan(&n); err != nil {
+		return 0, err
+	}
+	return uint64(n), nil
+}
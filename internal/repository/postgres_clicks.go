@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PostgresClickStore keeps click events in the "clicks" table.
+type PostgresClickStore struct {
+	db *sql.DB
+}
+
+func NewPostgresClickStore(db *sql.DB) *PostgresClickStore {
+	return &PostgresClickStore{db: db}
+}
+
+const clickColumns = `short_id, occurred_at, referrer, user_agent, ip_hash, accept_language, country`
+
+func (s *PostgresClickStore) InsertClicks(ctx context.Context, events []ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	defer observePostgres("InsertClicks", time.Now())
+	const perRow = 7
+	placeholders := make([]string, len(events))
+	args := make([]any, 0, len(events)*perRow)
+	for i, ev := range events {
+		n := i * perRow
+		placeholders[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7)
+		args = append(args, ev.ShortID, ev.Timestamp, ev.Referrer, ev.UserAgent, ev.IPHash, ev.AcceptLanguage, ev.Country)
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO clicks (`+clickColumns+`) VALUES `+strings.Join(placeholders, ", "),
+		args...,
+	)
+	return err
+}
+
+func (s *PostgresClickStore) ListClicks(ctx context.Context, shortID string, from, to time.Time) ([]ClickEvent, error) {
+	defer observePostgres("ListClicks", time.Now())
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+clickColumns+` FROM clicks
+		WHERE short_id = $1 AND occurred_at >= $2 AND occurred_at < $3
+		ORDER BY occurred_at`,
+		shortID, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []ClickEvent{}
+	for rows.Next() {
+		var ev ClickEvent
+		if err := rows.Scan(&ev.ShortID, &ev.Timestamp, &ev.Referrer, &ev.UserAgent, &ev.IPHash, &ev.AcceptLanguage, &ev.Country); err != nil {
+			return nil, err
+		}
+		results = append(results, ev)
+	}
+	return results, rows.Err()
+}
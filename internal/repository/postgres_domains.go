@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresDomainStore keeps domain rules in the "domain_rules" table.
+type PostgresDomainStore struct {
+	db *sql.DB
+}
+
+func NewPostgresDomainStore(db *sql.DB) *PostgresDomainStore {
+	return &PostgresDomainStore{db: db}
+}
+
+func (s *PostgresDomainStore) PutDomainRule(ctx context.Context, rule *DomainRule) error {
+	defer observePostgres("PutDomainRule", time.Now())
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO domain_rules (domain, action, reason, created_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (domain) DO UPDATE SET action = EXCLUDED.action, reason = EXCLUDED.reason, created_at = EXCLUDED.created_at`,
+		rule.Domain, rule.Action, rule.Reason, rule.CreatedAt,
+	)
+	return err
+}
+
+func (s *PostgresDomainStore) DeleteDomainRule(ctx context.Context, domain string) error {
+	defer observePostgres("DeleteDomainRule", time.Now())
+	res, err := s.db.ExecContext(ctx, `DELETE FROM domain_rules WHERE domain = $1`, domain)
+	return requireRow(res, err)
+}
+
+func (s *PostgresDomainStore) ListDomainRules(ctx context.Context) ([]DomainRule, error) {
+	defer observePostgres("ListDomainRules", time.Now())
+	rows, err := s.db.QueryContext(ctx, `SELECT domain, action, reason, created_at FROM domain_rules ORDER BY domain`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []DomainRule{}
+	for rows.Next() {
+		var rule DomainRule
+		if err := rows.Scan(&rule.Domain, &rule.Action, &rule.Reason, &rule.CreatedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, rule)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// PostgresKeyStore keeps API keys in the "api_keys" table. Scopes are stored
+// space-separated.
+type PostgresKeyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresKeyStore(db *sql.DB) *PostgresKeyStore {
+	return &PostgresKeyStore{db: db}
+}
+
+const keyColumns = `id, owner, name, hash, scopes, admin, created_at, expires_at, last_used_at, revoked_at`
+
+func scanKey(row rowScanner) (*APIKey, error) {
+	var key APIKey
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.Owner, &key.Name, &key.Hash, &scopes, &key.Admin, &key.CreatedAt,
+		&expiresAt, &lastUsedAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	key.ExpiresAt = nullTimePtr(expiresAt)
+	key.LastUsedAt = nullTimePtr(lastUsedAt)
+	key.RevokedAt = nullTimePtr(revokedAt)
+	return &key, nil
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func (s *PostgresKeyStore) CreateKey(ctx context.Context, key *APIKey) error {
+	defer observePostgres("InsertKey", time.Now())
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO api_keys (`+keyColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		key.ID, key.Owner, key.Name, key.Hash, strings.Join(key.Scopes, " "), key.Admin, key.CreatedAt,
+		key.ExpiresAt, key.LastUsedAt, key.RevokedAt,
+	)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (s *PostgresKeyStore) GetKey(ctx context.Context, id string) (*APIKey, error) {
+	defer observePostgres("SelectKey", time.Now())
+	return scanKey(s.db.QueryRowContext(ctx, `SELECT `+keyColumns+` FROM api_keys WHERE id = $1`, id))
+}
+
+func (s *PostgresKeyStore) ListKeys(ctx context.Context, owner string) ([]APIKey, error) {
+	defer observePostgres("ListKeys", time.Now())
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+keyColumns+` FROM api_keys WHERE $1 = '' OR owner = $1 ORDER BY created_at`,
+		owner,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []APIKey{}
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *key)
+	}
+	return results, rows.Err()
+}
+
+func (s *PostgresKeyStore) UpdateKey(ctx context.Context, key *APIKey) error {
+	defer observePostgres("UpdateKey", time.Now())
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE api_keys SET owner = $2, name = $3, hash = $4, scopes = $5, admin = $6,
+		expires_at = $7, last_used_at = $8, revoked_at = $9
+		WHERE id = $1`,
+		key.ID, key.Owner, key.Name, key.Hash, strings.Join(key.Scopes, " "), key.Admin,
+		key.ExpiresAt, key.LastUsedAt, key.RevokedAt,
+	)
+	return requireRow(res, err)
+}
+
+func (s *PostgresKeyStore) TouchKey(ctx context.Context, id string, at time.Time) error {
+	defer observePostgres("TouchKey", time.Now())
+	res, err := s.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $2 WHERE id = $1`, id, at)
+	return requireRow(res, err)
+}
+
+// requireRow maps an UPDATE that matched nothing to ErrNotFound.
+func requireRow(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
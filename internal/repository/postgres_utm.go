@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// PostgresUTMStore keeps owner UTM templates in the "owner_utm" table.
+type PostgresUTMStore struct {
+	db *sql.DB
+}
+
+func NewPostgresUTMStore(db *sql.DB) *PostgresUTMStore {
+	return &PostgresUTMStore{db: db}
+}
+
+func (s *PostgresUTMStore) PutOwnerUTM(ctx context.Context, t *OwnerUTM) error {
+	defer observePostgres("PutOwnerUTM", time.Now())
+	utm, err := json.Marshal(t.UTM)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO owner_utm (owner, utm, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (owner) DO UPDATE SET utm = EXCLUDED.utm, updated_at = EXCLUDED.updated_at`,
+		t.Owner, utm, t.UpdatedAt,
+	)
+	return err
+}
+
+func (s *PostgresUTMStore) GetOwnerUTM(ctx context.Context, owner string) (*OwnerUTM, error) {
+	defer observePostgres("GetOwnerUTM", time.Now())
+	t, err := scanOwnerUTM(s.db.QueryRowContext(ctx, `SELECT owner, utm, updated_at FROM owner_utm WHERE owner = $1`, owner))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return t, err
+}
+
+func (s *PostgresUTMStore) DeleteOwnerUTM(ctx context.Context, owner string) error {
+	defer observePostgres("DeleteOwnerUTM", time.Now())
+	res, err := s.db.ExecContext(ctx, `DELETE FROM owner_utm WHERE owner = $1`, owner)
+	return requireRow(res, err)
+}
+
+func (s *PostgresUTMStore) ListOwnerUTM(ctx context.Context) ([]OwnerUTM, error) {
+	defer observePostgres("ListOwnerUTM", time.Now())
+	rows, err := s.db.QueryContext(ctx, `SELECT owner, utm, updated_at FROM owner_utm ORDER BY owner`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []OwnerUTM{}
+	for rows.Next() {
+		t, err := scanOwnerUTM(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *t)
+	}
+	return results, rows.Err()
+}
+
+func scanOwnerUTM(row rowScanner) (*OwnerUTM, error) {
+	var t OwnerUTM
+	var utm []byte
+	if err := row.Scan(&t.Owner, &utm, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(utm, &t.UTM); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"cmp"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// DestinationDomain returns the lower-cased host of longURL.
+func DestinationDomain(longURL string) string {
+	u, err := url.Parse(longURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// linkDomain falls back to LongURL for links stored before Domain existed.
+func linkDomain(m *URLMapping) string {
+	if m.Domain != "" {
+		return m.Domain
+	}
+	return DestinationDomain(m.LongURL)
+}
+
+// matches applies f to a single link, for the stores that filter in Go.
+func (f LinkFilter) matches(m *URLMapping) bool {
+	switch {
+	case f.Owner != "" && m.Owner != f.Owner:
+		return false
+	case f.CreatedFrom != nil && m.Created.Before(*f.CreatedFrom):
+		return false
+	case f.CreatedTo != nil && !m.Created.Before(*f.CreatedTo):
+		return false
+	case f.Tag != "" && !slices.Contains(m.Tags, f.Tag):
+		return false
+	case f.Domain != "" && !strings.Contains(linkDomain(m), strings.ToLower(f.Domain)):
+		return false
+	}
+	return true
+}
+
+// CursorOf returns the list position of m.
+func CursorOf(m *URLMapping) ListCursor {
+	return ListCursor{Created: m.Created, AccessCount: m.AccessCount, ShortID: m.ShortID}
+}
+
+// compareCursors orders two positions ascending by sortKey, then short ID.
+func compareCursors(sortKey string, a, b ListCursor) int {
+	var c int
+	if sortKey == SortAccessCount {
+		c = cmp.Compare(a.AccessCount, b.AccessCount)
+	} else {
+		c = a.Created.Compare(b.Created)
+	}
+	if c != 0 {
+		return c
+	}
+	return strings.Compare(a.ShortID, b.ShortID)
+}
+
+// selectLinks filters, sorts and pages links in Go. It is shared by the
+// stores without a query engine.
+func selectLinks(links []URLMapping, opts ListOptions) []URLMapping {
+	direction := -1
+	if opts.Asc {
+		direction = 1
+	}
+	results := []URLMapping{}
+	for i := range links {
+		m := &links[i]
+		if !opts.Filter.matches(m) {
+			continue
+		}
+		if opts.After != nil && compareCursors(opts.Sort, CursorOf(m), *opts.After)*direction <= 0 {
+			continue
+		}
+		results = append(results, *m)
+	}
+	slices.SortFunc(results, func(a, b URLMapping) int {
+		return compareCursors(opts.Sort, CursorOf(&a), CursorOf(&b)) * direction
+	})
+	if opts.Limit > 0 && opts.Limit < len(results) {
+		results = results[:opts.Limit]
+	}
+	return results
+}
+
+// findReusable is the in-Go implementation of LinkStore.FindReusable.
+func findReusable(links []URLMapping, owner, normalizedURL string) (*URLMapping, error) {
+	var best *URLMapping
+	for i := range links {
+		m := &links[i]
+		if m.Owner != owner || m.NormalizedURL != normalizedURL || !m.Reusable() {
+			continue
+		}
+		if best == nil || m.Created.After(best.Created) {
+			best = m
+		}
+	}
+	if best == nil {
+		return nil, ErrNotFound
+	}
+	return best, nil
+}
+
+func countLinks(links []URLMapping, filter LinkFilter) int64 {
+	var n int64
+	for i := range links {
+		if filter.matches(&links[i]) {
+			n++
+		}
+	}
+	return n
+}
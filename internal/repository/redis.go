@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+func NewRedisClient(ctx context.Context, addr string) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr: addr,
+		DB:   0,
+	})
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	log.Println("✅ Connected to Redis")
+	return client, nil
+}
+
+// RedisCache is the default Cache implementation.
+type RedisCache struct {
+	client *redis.Client
+}
+
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{client: client}
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (string, error) {
+	start := time.Now()
+	val, err := c.client.Get(ctx, key).Result()
+	metrics.RedisOpDuration.WithLabelValues("GET").Observe(time.Since(start).Seconds())
+	if err == redis.Nil {
+		return "", ErrCacheMiss
+	}
+	return val, err
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	start := time.Now()
+	err := c.client.Set(ctx, key, value, ttl).Err()
+	metrics.RedisOpDuration.WithLabelValues("SET").Observe(time.Since(start).Seconds())
+	return err
+}
+
+// SetMany writes every entry in a single pipelined round trip.
+func (c *RedisCache) SetMany(ctx context.Context, entries []CacheEntry) error {
+	start := time.Now()
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, e := range entries {
+			pipe.Set(ctx, e.Key, e.Value, e.TTL)
+		}
+		return nil
+	})
+	metrics.RedisOpDuration.WithLabelValues("PIPELINE_SET").Observe(time.Since(start).Seconds())
+	return err
+}
+
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	err := c.client.Del(ctx, key).Err()
+	metrics.RedisOpDuration.WithLabelValues("DEL").Observe(time.Since(start).Seconds())
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
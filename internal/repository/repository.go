@@ -2,47 +2,327 @@ package repository
 
 import (
 	"context"
-	"fmt"
-	"log"
-	"os"
+	"errors"
 	"time"
-
-	"github.com/redis/go-redis/v9"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
-	MongoClient *mongo.Client
-	RedisClient *redis.Client
+	ErrNotFound  = errors.New("link not found")
+	ErrDuplicate = errors.New("short ID already exists")
+	ErrExhausted = errors.New("click limit reached")
+	ErrConflict  = errors.New("link was modified concurrently")
+	ErrCacheMiss = errors.New("cache miss")
+	// ErrAtomicUnsupported is returned by BulkCreator.CreateMany when the
+	// store cannot insert a batch atomically.
+	ErrAtomicUnsupported = errors.New("atomic batches are not supported by this store")
+)
+
+type URLMapping struct {
+	ShortID     string     `bson:"short_id" json:"short_id"`
+	LongURL     string     `bson:"long_url" json:"long_url"`
+	Created     time.Time  `bson:"created_at" json:"created_at"`
+	AccessCount int        `bson:"access_count" json:"access_count"`
+	ExpiresAt   *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	MaxClicks   int        `bson:"max_clicks,omitempty" json:"max_clicks,omitempty"`
+	// RedirectType is the HTTP status used to redirect; zero means the server default.
+	RedirectType int `bson:"redirect_type,omitempty" json:"redirect_type,omitempty"`
+	// Owner is the API key owner that created the link. Links created before
+	// ownership was recorded have none and can only be managed by admins.
+	Owner        string   `bson:"owner,omitempty" json:"owner,omitempty"`
+	StatsPrivate bool     `bson:"stats_private,omitempty" json:"stats_private,omitempty"`
+	Tags         []string `bson:"tags,omitempty" json:"tags,omitempty"`
+	// Domain is the lower-cased host of LongURL, kept for filtering.
+	Domain string `bson:"domain,omitempty" json:"domain,omitempty"`
+	// NormalizedURL is the canonical form of LongURL used to find an
+	// existing link for the same destination.
+	NormalizedURL string `bson:"normalized_url,omitempty" json:"normalized_url,omitempty"`
+	// Interstitial shows visitors the preview page instead of redirecting
+	// them straight away.
+	Interstitial bool `bson:"interstitial,omitempty" json:"interstitial,omitempty"`
+	// Rules send visitors matching them elsewhere than LongURL. They are
+	// evaluated in order and the first match wins.
+	Rules []TargetRule `bson:"rules,omitempty" json:"rules,omitempty"`
+	// Variants split the visitors not sent elsewhere by Rules across
+	// several destinations by weight.
+	Variants []Variant `bson:"variants,omitempty" json:"variants,omitempty"`
+	// VariantClicks counts the visits sent to each variant by ID. Like
+	// AccessCount, it is only changed by IncrementVariantCount.
+	VariantClicks map[string]int `bson:"variant_clicks,omitempty" json:"variant_clicks,omitempty"`
+	// UTM is added to the query of the destination on every redirect.
+	UTM *UTM `bson:"utm,omitempty" json:"utm,omitempty"`
+	// QueryPassthrough forwards the query string of the short URL to the
+	// destination.
+	QueryPassthrough bool `bson:"query_passthrough,omitempty" json:"query_passthrough,omitempty"`
+	// PasswordHash is the bcrypt hash of the password visitors must enter
+	// before being redirected. It is stored and cached with the link but
+	// never returned by the API.
+	PasswordHash string `bson:"password_hash,omitempty" json:"password_hash,omitempty"`
+	// Version is bumped on every Update and guards against lost updates.
+	Version int                 `bson:"version" json:"version"`
+	History []DestinationChange `bson:"history,omitempty" json:"history,omitempty"`
+}
+
+// DestinationChange records a destination that a link pointed to before an update.
+type DestinationChange struct {
+	LongURL    string    `bson:"long_url" json:"long_url"`
+	ReplacedAt time.Time `bson:"replaced_at" json:"replaced_at"`
+}
+
+// TargetRule sends visitors that match every one of its conditions to
+// LongURL. Conditions left empty match every visitor.
+type TargetRule struct {
+	// Platforms match the visitor's operating system (ios, android, windows,
+	// macos, linux, chromeos) or device type (mobile, tablet, desktop, bot).
+	Platforms []string `bson:"platforms,omitempty" json:"platforms,omitempty"`
+	// Languages match the visitor's preferred language; "pt" matches "pt-BR".
+	Languages []string `bson:"languages,omitempty" json:"languages,omitempty"`
+	// Countries match the ISO 3166-1 alpha-2 code of the visitor's country,
+	// resolved from the IP with the GeoIP database.
+	Countries []string `bson:"countries,omitempty" json:"countries,omitempty"`
+	// From and Until bound the time window in which the rule applies, from
+	// inclusive, until exclusive.
+	From    *time.Time `bson:"from,omitempty" json:"from,omitempty"`
+	Until   *time.Time `bson:"until,omitempty" json:"until,omitempty"`
+	LongURL string     `bson:"long_url" json:"long_url"`
+}
+
+// Variant is one of the destinations a link splits its traffic across.
+type Variant struct {
+	ID      string `bson:"id" json:"id"`
+	LongURL string `bson:"long_url" json:"long_url"`
+	// Weight is the share of visitors sent to the variant, relative to the
+	// sum of the weights of every variant.
+	Weight int `bson:"weight" json:"weight"`
+}
+
+// UTM is a template of UTM parameters. Values are plain text and may use the
+// {short_id}, {variant} and {country} placeholders, expanded per visit.
+type UTM struct {
+	Source   string `bson:"source,omitempty" json:"source,omitempty"`
+	Medium   string `bson:"medium,omitempty" json:"medium,omitempty"`
+	Campaign string `bson:"campaign,omitempty" json:"campaign,omitempty"`
+	Term     string `bson:"term,omitempty" json:"term,omitempty"`
+	Content  string `bson:"content,omitempty" json:"content,omitempty"`
+}
+
+// Expired reports whether the link has an expiry that is not after now.
+func (m *URLMapping) Expired(now time.Time) bool {
+	return m.ExpiresAt != nil && !m.ExpiresAt.After(now)
+}
+
+// Protected reports whether visitors need a password to follow the link.
+func (m *URLMapping) Protected() bool {
+	return m.PasswordHash != ""
+}
+
+// Direct reports whether the link always sends visitors straight to LongURL:
+// no password, targeting rules, variants, UTM template or query passthrough.
+func (m *URLMapping) Direct() bool {
+	return !m.Protected() && len(m.Rules) == 0 && len(m.Variants) == 0 &&
+		m.UTM == nil && !m.QueryPassthrough
+}
+
+// Reusable reports whether the link is a Direct, permanent redirect with
+// every option at its default: no expiry, click limit, redirect type,
+// interstitial or private stats. Only such links are handed out again by
+// FindReusable, so reuse never changes how a link behaves.
+func (m *URLMapping) Reusable() bool {
+	return m.Direct() && m.ExpiresAt == nil && m.MaxClicks == 0 && m.RedirectType == 0 &&
+		!m.Interstitial && !m.StatsPrivate
+}
+
+// Exhausted reports whether the link has reached its click limit.
+func (m *URLMapping) Exhausted() bool {
+	return m.MaxClicks > 0 && m.AccessCount >= m.MaxClicks
+}
+
+// Sort keys accepted by List.
+const (
+	SortCreatedAt   = "created_at"
+	SortAccessCount = "access_count"
 )
 
-func InitClients() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// MongoDB
-	mongoURI := os.Getenv("MONGO_URI")
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
-	if err != nil {
-		return fmt.Errorf("failed to connect to MongoDB: %w", err)
-	}
-	if err := client.Ping(ctx, nil); err != nil {
-		return fmt.Errorf("MongoDB ping failed: %w", err)
-	}
-	MongoClient = client
-	log.Println("✅ Connected to MongoDB")
-
-	// Redis
-	redisAddr := os.Getenv("REDIS_ADDR")
-	RedisClient = redis.NewClient(&redis.Options{
-		Addr: redisAddr,
-		DB:   0,
-	})
-	if err := RedisClient.Ping(ctx).Err(); err != nil {
-		return fmt.Errorf("failed to connect to Redis: %w", err)
-	}
-	log.Println("✅ Connected to Redis")
-
-	return nil
+// LinkFilter narrows List and Count. Zero fields match every link.
+type LinkFilter struct {
+	Owner       string
+	CreatedFrom *time.Time // inclusive
+	CreatedTo   *time.Time // exclusive
+	Tag         string
+	// Domain matches links whose destination host contains it.
+	Domain string
+}
+
+// ListCursor is the position of the last link of the previous page.
+type ListCursor struct {
+	Created     time.Time
+	AccessCount int
+	ShortID     string
+}
+
+// ListOptions selects a page of links. Links are ordered by Sort, then by
+// short ID in the same direction, and After skips every link up to and
+// including the cursor position.
+type ListOptions struct {
+	Filter LinkFilter
+	Sort   string // SortCreatedAt (default) or SortAccessCount
+	Asc    bool
+	Limit  int
+	After  *ListCursor
+}
+
+// LinkStore is the durable storage for short links.
+type LinkStore interface {
+	// Create inserts a new link and returns ErrDuplicate if the short ID is taken.
+	Create(ctx context.Context, m *URLMapping) error
+	Get(ctx context.Context, shortID string) (*URLMapping, error)
+	Delete(ctx context.Context, shortID string) error
+	// Update overwrites the mutable fields of an existing link, leaving its
+	// access and variant counts untouched. It fails with ErrConflict unless the stored
+	// version equals m.Version, and bumps m.Version on success.
+	Update(ctx context.Context, m *URLMapping) error
+	// IncrementAccessCount atomically bumps the access counter and returns the
+	// updated mapping. Links with MaxClicks set are never counted past the
+	// limit; ErrExhausted is returned instead.
+	IncrementAccessCount(ctx context.Context, shortID string) (*URLMapping, error)
+	// IncrementVariantCount atomically bumps the click counter of the variant
+	// variantID of shortID.
+	IncrementVariantCount(ctx context.Context, shortID, variantID string) error
+	List(ctx context.Context, opts ListOptions) ([]URLMapping, error)
+	Count(ctx context.Context, filter LinkFilter) (int64, error)
+	// FindReusable returns the newest Reusable link of owner whose
+	// NormalizedURL is normalizedURL, or ErrNotFound.
+	FindReusable(ctx context.Context, owner, normalizedURL string) (*URLMapping, error)
+}
+
+// BulkCreator is implemented by stores that can insert many links in one
+// round trip.
+type BulkCreator interface {
+	// CreateMany inserts links and returns one error per link, nil on success
+	// and ErrDuplicate for a taken short ID. With atomic set, either every link
+	// is inserted or none is, or the call fails with ErrAtomicUnsupported.
+	// The second return value reports failures of the batch as a whole.
+	CreateMany(ctx context.Context, links []*URLMapping, atomic bool) ([]error, error)
+}
+
+// Sequencer is implemented by stores that can hand out a durable, monotonically
+// increasing counter, used by the counter-based short ID generator.
+type Sequencer interface {
+	NextSequence(ctx context.Context) (uint64, error)
+}
+
+// ExpiredPurger is implemented by stores that need an explicit sweep to drop
+// expired links. Mongo relies on a TTL index instead.
+type ExpiredPurger interface {
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// ClickEvent is a single redirect as recorded for analytics. The visitor IP is
+// only ever stored hashed.
+type ClickEvent struct {
+	ShortID        string    `bson:"short_id" json:"short_id"`
+	Timestamp      time.Time `bson:"timestamp" json:"timestamp"`
+	Referrer       string    `bson:"referrer,omitempty" json:"referrer,omitempty"`
+	UserAgent      string    `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	IPHash         string    `bson:"ip_hash,omitempty" json:"ip_hash,omitempty"`
+	AcceptLanguage string    `bson:"accept_language,omitempty" json:"accept_language,omitempty"`
+	// Country is the ISO code of the visitor's country, when known.
+	Country string `bson:"country,omitempty" json:"country,omitempty"`
+}
+
+// ClickStore persists click events, separately from the links themselves.
+type ClickStore interface {
+	InsertClicks(ctx context.Context, events []ClickEvent) error
+	// ListClicks returns the events of shortID with from <= timestamp < to,
+	// oldest first.
+	ListClicks(ctx context.Context, shortID string, from, to time.Time) ([]ClickEvent, error)
+}
+
+// APIKey is a credential for the management API. Only a hash of the secret
+// is stored; the plaintext is shown once, when the key is created or rotated.
+type APIKey struct {
+	ID         string     `bson:"key_id" json:"id"`
+	Owner      string     `bson:"owner" json:"owner"`
+	Name       string     `bson:"name" json:"name"`
+	Hash       string     `bson:"hash" json:"hash"`
+	Scopes     []string   `bson:"scopes" json:"scopes"`
+	Admin      bool       `bson:"admin,omitempty" json:"admin,omitempty"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	ExpiresAt  *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+// KeyStore persists API keys.
+type KeyStore interface {
+	// CreateKey returns ErrDuplicate when the key ID is taken.
+	CreateKey(ctx context.Context, key *APIKey) error
+	GetKey(ctx context.Context, id string) (*APIKey, error)
+	// ListKeys returns the keys of owner, or every key when owner is empty,
+	// oldest first.
+	ListKeys(ctx context.Context, owner string) ([]APIKey, error)
+	// UpdateKey replaces a stored key.
+	UpdateKey(ctx context.Context, key *APIKey) error
+	TouchKey(ctx context.Context, id string, at time.Time) error
+}
+
+// Domain rule actions.
+const (
+	DomainBlock = "block"
+	DomainAllow = "allow"
+)
+
+// DomainRule blocks or allows a domain and all of its subdomains. The most
+// specific rule matching a host wins, so an allow rule can exempt a subdomain
+// of a blocked domain.
+type DomainRule struct {
+	Domain    string    `bson:"domain" json:"domain"`
+	Action    string    `bson:"action" json:"action"`
+	Reason    string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// DomainStore persists the domain rules managed through the admin API.
+type DomainStore interface {
+	// PutDomainRule creates the rule for rule.Domain or replaces it.
+	PutDomainRule(ctx context.Context, rule *DomainRule) error
+	DeleteDomainRule(ctx context.Context, domain string) error
+	// ListDomainRules returns every rule ordered by domain.
+	ListDomainRules(ctx context.Context) ([]DomainRule, error)
+}
+
+// OwnerUTM is the UTM template applied to every link of an owner.
+type OwnerUTM struct {
+	Owner     string    `bson:"owner" json:"owner"`
+	UTM       UTM       `bson:"utm" json:"utm"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// UTMStore persists the UTM templates of owners.
+type UTMStore interface {
+	// PutOwnerUTM creates the template of t.Owner or replaces it.
+	PutOwnerUTM(ctx context.Context, t *OwnerUTM) error
+	GetOwnerUTM(ctx context.Context, owner string) (*OwnerUTM, error)
+	DeleteOwnerUTM(ctx context.Context, owner string) error
+	// ListOwnerUTM returns every template ordered by owner.
+	ListOwnerUTM(ctx context.Context) ([]OwnerUTM, error)
+}
+
+// CacheEntry is a single write of BulkCache.SetMany.
+type CacheEntry struct {
+	Key   string
+	Value string
+	TTL   time.Duration
+}
+
+// BulkCache is implemented by caches that can write many entries at once.
+type BulkCache interface {
+	SetMany(ctx context.Context, entries []CacheEntry) error
+}
+
+// Cache is a best-effort key/value cache in front of the LinkStore.
+// Get returns ErrCacheMiss when the key is absent.
+type Cache interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
 }
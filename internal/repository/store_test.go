@@ -0,0 +1,419 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func embeddedStores(t *testing.T) map[string]LinkStore {
+	db, err := OpenBolt(filepath.Join(t.TempDir(), "shortener.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	stores := map[string]LinkStore{
+		"memory": NewMemoryLinkStore(),
+		"bolt":   NewBoltLinkStore(db),
+	}
+	if pg := postgresDB(t); pg != nil {
+		stores["postgres"] = NewPostgresLinkStore(pg)
+	}
+	return stores
+}
+
+func TestLinkStore_Lifecycle(t *testing.T) {
+	for name, store := range embeddedStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			created := time.Now().UTC().Truncate(time.Millisecond)
+
+			require.NoError(t, store.Create(ctx, &URLMapping{ShortID: "abc12345", LongURL: "https://example.com", Created: created}))
+			require.NoError(t, store.Create(ctx, &URLMapping{ShortID: "def67890", LongURL: "https://example.org", Created: created.Add(time.Second)}))
+
+			err := store.Create(ctx, &URLMapping{ShortID: "abc12345", LongURL: "https://example.net", Created: created})
+			assert.ErrorIs(t, err, ErrDuplicate)
+
+			got, err := store.Get(ctx, "abc12345")
+			require.NoError(t, err)
+			assert.Equal(t, "https://example.com", got.LongURL)
+			assert.True(t, created.Equal(got.Created))
+
+			updated, err := store.IncrementAccessCount(ctx, "abc12345")
+			require.NoError(t, err)
+			assert.Equal(t, 1, updated.AccessCount)
+
+			list, err := store.List(ctx, ListOptions{Limit: 1})
+			require.NoError(t, err)
+			require.Len(t, list, 1)
+			assert.Equal(t, "def67890", list[0].ShortID)
+
+			require.NoError(t, store.Delete(ctx, "abc12345"))
+			_, err = store.Get(ctx, "abc12345")
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, store.Delete(ctx, "abc12345"), ErrNotFound)
+			_, err = store.IncrementAccessCount(ctx, "abc12345")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestLinkStore_Update(t *testing.T) {
+	for name, store := range embeddedStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			require.NoError(t, store.Create(ctx, &URLMapping{ShortID: "qrcode01", LongURL: "https://example.com", Created: time.Now()}))
+			_, err := store.IncrementAccessCount(ctx, "qrcode01")
+			require.NoError(t, err)
+
+			stale, err := store.Get(ctx, "qrcode01")
+			require.NoError(t, err)
+			// Counted after the read: the update must not overwrite it.
+			require.NoError(t, store.IncrementVariantCount(ctx, "qrcode01", "b"))
+			fresh := *stale
+			fresh.LongURL = "https://example.org"
+			fresh.History = []DestinationChange{{LongURL: "https://example.com", ReplacedAt: time.Now()}}
+			require.NoError(t, store.Update(ctx, &fresh))
+			assert.Equal(t, stale.Version+1, fresh.Version)
+
+			stale.LongURL = "https://example.net"
+			assert.ErrorIs(t, store.Update(ctx, stale), ErrConflict)
+
+			got, err := store.Get(ctx, "qrcode01")
+			require.NoError(t, err)
+			assert.Equal(t, "https://example.org", got.LongURL)
+			assert.Equal(t, 1, got.AccessCount)
+			assert.Equal(t, map[string]int{"b": 1}, got.VariantClicks)
+			require.Len(t, got.History, 1)
+			assert.Equal(t, "https://example.com", got.History[0].LongURL)
+
+			assert.ErrorIs(t, store.Update(ctx, &URLMapping{ShortID: "missing1"}), ErrNotFound)
+			assert.ErrorIs(t, store.IncrementVariantCount(ctx, "missing1", "b"), ErrNotFound)
+		})
+	}
+}
+
+func TestLinkStore_DeleteExpired(t *testing.T) {
+	for name, store := range embeddedStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now()
+			past, future := now.Add(-time.Minute), now.Add(time.Hour)
+
+			require.NoError(t, store.Create(ctx, &URLMapping{ShortID: "expired1", LongURL: "https://example.com", Created: now, ExpiresAt: &past}))
+			require.NoError(t, store.Create(ctx, &URLMapping{ShortID: "future01", LongURL: "https://example.com", Created: now, ExpiresAt: &future}))
+			require.NoError(t, store.Create(ctx, &URLMapping{ShortID: "forever1", LongURL: "https://example.com", Created: now}))
+
+			n, err := store.(ExpiredPurger).DeleteExpired(ctx, now)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), n)
+
+			_, err = store.Get(ctx, "expired1")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = store.Get(ctx, "future01")
+			assert.NoError(t, err)
+			_, err = store.Get(ctx, "forever1")
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestLinkStore_MaxClicks(t *testing.T) {
+	for name, store := range embeddedStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			require.NoError(t, store.Create(ctx, &URLMapping{ShortID: "twice123", LongURL: "https://example.com", Created: time.Now(), MaxClicks: 2}))
+
+			var wg sync.WaitGroup
+			var ok, exhausted atomic.Int32
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := store.IncrementAccessCount(ctx, "twice123")
+					if err == nil {
+						ok.Add(1)
+					} else if errors.Is(err, ErrExhausted) {
+						exhausted.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			assert.Equal(t, int32(2), ok.Load())
+			assert.Equal(t, int32(8), exhausted.Load())
+			got, err := store.Get(ctx, "twice123")
+			require.NoError(t, err)
+			assert.Equal(t, 2, got.AccessCount)
+		})
+	}
+}
+
+func TestLinkStore_FindReusable(t *testing.T) {
+	for name, store := range embeddedStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Millisecond)
+			past, future := now.Add(-time.Minute), now.Add(time.Hour)
+			link := func(id string, age time.Duration) *URLMapping {
+				return &URLMapping{ShortID: id, LongURL: "https://example.com/p", NormalizedURL: "https://example.com/p",
+					Owner: "team", Created: now.Add(-age)}
+			}
+
+			_, err := store.FindReusable(ctx, "team", "https://example.com/p")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			// Only the oldest match has every option at its default; every
+			// newer one, live or not, must be skipped rather than end the
+			// search.
+			require.NoError(t, store.Create(ctx, link("older001", 24*time.Hour)))
+			for i, set := range []func(m *URLMapping){
+				func(m *URLMapping) { m.ExpiresAt = &past },
+				func(m *URLMapping) { m.ExpiresAt = &future },
+				func(m *URLMapping) { m.MaxClicks = 1 },
+				func(m *URLMapping) { m.MaxClicks = 100 },
+				func(m *URLMapping) { m.RedirectType = 302 },
+				func(m *URLMapping) { m.Interstitial = true },
+				func(m *URLMapping) { m.StatsPrivate = true },
+				func(m *URLMapping) {
+					m.Rules = []TargetRule{{Countries: []string{"BR"}, LongURL: "https://example.com/br"}}
+				},
+				func(m *URLMapping) {
+					m.Variants = []Variant{{ID: "a", LongURL: "https://example.com/a", Weight: 1}}
+				},
+				func(m *URLMapping) { m.UTM = &UTM{Source: "news"} },
+				func(m *URLMapping) { m.QueryPassthrough = true },
+				func(m *URLMapping) { m.PasswordHash = "hash" },
+			} {
+				m := link(fmt.Sprintf("option%02d", i), time.Duration(i)*time.Minute)
+				set(m)
+				require.NoError(t, store.Create(ctx, m))
+			}
+			_, err = store.IncrementAccessCount(ctx, "option02")
+			require.NoError(t, err)
+
+			got, err := store.FindReusable(ctx, "team", "https://example.com/p")
+			require.NoError(t, err)
+			assert.Equal(t, "older001", got.ShortID)
+
+			_, err = store.FindReusable(ctx, "other", "https://example.com/p")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestLinkStore_ListFiltersAndCursor(t *testing.T) {
+	for name, store := range embeddedStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			base := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+			links := []URLMapping{
+				{ShortID: "a1", LongURL: "https://docs.example.com/x", Owner: "team-a", Tags: []string{"docs"}, AccessCount: 5},
+				{ShortID: "a2", LongURL: "https://example.org", Owner: "team-a", AccessCount: 9},
+				{ShortID: "a3", LongURL: "https://blog.example.com", Owner: "team-a", Tags: []string{"docs", "blog"}, AccessCount: 5},
+				{ShortID: "b1", LongURL: "https://other.net", Owner: "team-b", Tags: []string{"docs"}},
+			}
+			for i := range links {
+				links[i].Created = base.Add(time.Duration(i) * time.Hour)
+				require.NoError(t, store.Create(ctx, &links[i]))
+			}
+
+			filter := LinkFilter{Owner: "team-a"}
+			n, err := store.Count(ctx, filter)
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), n)
+
+			var ids []string
+			opts := ListOptions{Filter: filter, Sort: SortAccessCount, Limit: 2}
+			for {
+				page, err := store.List(ctx, opts)
+				require.NoError(t, err)
+				for _, m := range page {
+					ids = append(ids, m.ShortID)
+				}
+				if len(page) < opts.Limit {
+					break
+				}
+				last := CursorOf(&page[len(page)-1])
+				opts.After = &last
+			}
+			assert.Equal(t, []string{"a2", "a3", "a1"}, ids)
+
+			page, err := store.List(ctx, ListOptions{Filter: LinkFilter{Tag: "docs", Domain: "EXAMPLE.com"}, Asc: true})
+			require.NoError(t, err)
+			require.Len(t, page, 2)
+			assert.Equal(t, "a1", page[0].ShortID)
+			assert.Equal(t, "a3", page[1].ShortID)
+
+			from, to := base.Add(time.Hour), base.Add(3*time.Hour)
+			n, err = store.Count(ctx, LinkFilter{CreatedFrom: &from, CreatedTo: &to})
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), n)
+		})
+	}
+}
+
+func TestLinkStore_CreateMany(t *testing.T) {
+	for name, store := range embeddedStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			bulk := store.(BulkCreator)
+			require.NoError(t, store.Create(ctx, &URLMapping{ShortID: "taken", LongURL: "https://example.com"}))
+
+			errs, err := bulk.CreateMany(ctx, []*URLMapping{
+				{ShortID: "atomic1", LongURL: "https://example.com/1"},
+				{ShortID: "taken", LongURL: "https://example.com/2"},
+			}, true)
+			require.NoError(t, err)
+			assert.NoError(t, errs[0])
+			assert.ErrorIs(t, errs[1], ErrDuplicate)
+			_, err = store.Get(ctx, "atomic1")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			errs, err = bulk.CreateMany(ctx, []*URLMapping{
+				{ShortID: "bulk1", LongURL: "https://example.com/1"},
+				{ShortID: "taken", LongURL: "https://example.com/2"},
+				{ShortID: "bulk1", LongURL: "https://example.com/3"},
+			}, false)
+			require.NoError(t, err)
+			assert.NoError(t, errs[0])
+			assert.ErrorIs(t, errs[1], ErrDuplicate)
+			assert.ErrorIs(t, errs[2], ErrDuplicate)
+			got, err := store.Get(ctx, "bulk1")
+			require.NoError(t, err)
+			assert.Equal(t, "https://example.com/1", got.LongURL)
+		})
+	}
+}
+
+func TestMemoryCache_Expiry(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache()
+
+	require.NoError(t, cache.Set(ctx, "k", "v", time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	_, err := cache.Get(ctx, "k")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+
+	require.NoError(t, cache.Set(ctx, "k", "v", time.Hour))
+	v, err := cache.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "v", v)
+}
+
+func TestClickStore_RangeQuery(t *testing.T) {
+	db, err := OpenBolt(filepath.Join(t.TempDir(), "clicks.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	stores := map[string]ClickStore{
+		"memory": NewMemoryClickStore(),
+		"bolt":   NewBoltClickStore(db),
+	}
+	if pg := postgresDB(t); pg != nil {
+		stores["postgres"] = NewPostgresClickStore(pg)
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			require.NoError(t, store.InsertClicks(ctx, []ClickEvent{
+				{ShortID: "abc12345", Timestamp: base.Add(2 * time.Hour), Referrer: "https://news.ycombinator.com/"},
+				{ShortID: "abc12345", Timestamp: base, UserAgent: "curl/8.0"},
+				{ShortID: "abc12345", Timestamp: base.Add(time.Hour), IPHash: "h1"},
+				{ShortID: "abc1234", Timestamp: base},
+				{ShortID: "abc12345", Timestamp: base.Add(3 * time.Hour)},
+			}))
+
+			got, err := store.ListClicks(ctx, "abc12345", base, base.Add(3*time.Hour))
+			require.NoError(t, err)
+			require.Len(t, got, 3)
+			assert.True(t, base.Equal(got[0].Timestamp))
+			assert.Equal(t, "curl/8.0", got[0].UserAgent)
+			assert.Equal(t, "h1", got[1].IPHash)
+			assert.Equal(t, "https://news.ycombinator.com/", got[2].Referrer)
+		})
+	}
+}
+
+func TestDomainStore(t *testing.T) {
+	db, err := OpenBolt(filepath.Join(t.TempDir(), "domains.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	stores := map[string]DomainStore{
+		"memory": NewMemoryDomainStore(),
+		"bolt":   NewBoltDomainStore(db),
+	}
+	if pg := postgresDB(t); pg != nil {
+		stores["postgres"] = NewPostgresDomainStore(pg)
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			require.NoError(t, store.PutDomainRule(ctx, &DomainRule{Domain: "phish.example", Action: DomainBlock, CreatedAt: now}))
+			require.NoError(t, store.PutDomainRule(ctx, &DomainRule{Domain: "bad.example", Action: DomainBlock, CreatedAt: now}))
+			require.NoError(t, store.PutDomainRule(ctx, &DomainRule{Domain: "phish.example", Action: DomainBlock, Reason: "phishing kit", CreatedAt: now}))
+
+			rules, err := store.ListDomainRules(ctx)
+			require.NoError(t, err)
+			require.Len(t, rules, 2)
+			assert.Equal(t, "bad.example", rules[0].Domain)
+			assert.Equal(t, "phishing kit", rules[1].Reason)
+
+			require.NoError(t, store.DeleteDomainRule(ctx, "bad.example"))
+			assert.ErrorIs(t, store.DeleteDomainRule(ctx, "bad.example"), ErrNotFound)
+			rules, err = store.ListDomainRules(ctx)
+			require.NoError(t, err)
+			assert.Len(t, rules, 1)
+		})
+	}
+}
+
+func TestUTMStore(t *testing.T) {
+	db, err := OpenBolt(filepath.Join(t.TempDir(), "utm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	stores := map[string]UTMStore{
+		"memory": NewMemoryUTMStore(),
+		"bolt":   NewBoltUTMStore(db),
+	}
+	if pg := postgresDB(t); pg != nil {
+		stores["postgres"] = NewPostgresUTMStore(pg)
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC()
+			require.NoError(t, store.PutOwnerUTM(ctx, &OwnerUTM{Owner: "team-b", UTM: UTM{Source: "newsletter"}, UpdatedAt: now}))
+			require.NoError(t, store.PutOwnerUTM(ctx, &OwnerUTM{Owner: "team-a", UTM: UTM{Source: "social"}, UpdatedAt: now}))
+			require.NoError(t, store.PutOwnerUTM(ctx, &OwnerUTM{Owner: "team-b", UTM: UTM{Source: "email", Medium: "crm"}, UpdatedAt: now}))
+
+			got, err := store.GetOwnerUTM(ctx, "team-b")
+			require.NoError(t, err)
+			assert.Equal(t, UTM{Source: "email", Medium: "crm"}, got.UTM)
+			_, err = store.GetOwnerUTM(ctx, "team-c")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			templates, err := store.ListOwnerUTM(ctx)
+			require.NoError(t, err)
+			require.Len(t, templates, 2)
+			assert.Equal(t, "team-a", templates[0].Owner)
+
+			require.NoError(t, store.DeleteOwnerUTM(ctx, "team-a"))
+			assert.ErrorIs(t, store.DeleteOwnerUTM(ctx, "team-a"), ErrNotFound)
+			templates, err = store.ListOwnerUTM(ctx)
+			require.NoError(t, err)
+			assert.Len(t, templates, 1)
+		})
+	}
+}
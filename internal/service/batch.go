@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// DefaultMaxBatchSize is the number of items ShortenBatch accepts unless
+// overridden with WithMaxBatchSize.
+const DefaultMaxBatchSize = 1000
+
+// DefaultMaxBatchPasswords is the number of password-protected items
+// ShortenBatch accepts unless overridden with WithMaxBatchPasswords. Every
+// password is hashed with bcrypt, which takes tens of milliseconds of CPU.
+const DefaultMaxBatchPasswords = 20
+
+var (
+	ErrEmptyBatch    = errors.New("batch has no items")
+	ErrBatchTooLarge = errors.New("batch is too large")
+	ErrBatchAborted  = errors.New("not created: another item of the batch failed")
+	// ErrAtomicUnsupported means the store cannot honor an atomic batch.
+	ErrAtomicUnsupported = repository.ErrAtomicUnsupported
+)
+
+// WithMaxBatchSize bounds the number of items of a ShortenBatch call.
+func WithMaxBatchSize(n int) Option {
+	return func(s *Shortener) {
+		if n > 0 {
+			s.maxBatchSize = n
+		}
+	}
+}
+
+func (s *Shortener) MaxBatchSize() int {
+	return s.maxBatchSize
+}
+
+// WithMaxBatchPasswords bounds the number of items with a password in a
+// ShortenBatch call.
+func WithMaxBatchPasswords(n int) Option {
+	return func(s *Shortener) {
+		if n > 0 {
+			s.maxBatchPasswords = n
+		}
+	}
+}
+
+// BatchItem is one URL of a ShortenBatch call.
+type BatchItem struct {
+	LongURL string
+	Options ShortenOptions
+}
+
+// BatchResult is the outcome of one BatchItem: the stored link or an error.
+// Reused reports that Link already existed, under ShortenOptions.ReuseExisting.
+type BatchResult struct {
+	Link   *URLMapping
+	Reused bool
+	Err    error
+}
+
+// ShortenBatch creates a link per item with bulk writes to the store and the
+// cache. Results are in item order. Without atomic, every valid item is
+// stored independently; with atomic, either all items are stored or none
+// is, and the items that did not fail themselves report ErrBatchAborted.
+func (s *Shortener) ShortenBatch(ctx context.Context, items []BatchItem, atomic bool) ([]BatchResult, error) {
+	ctx, span := tracer.Start(ctx, "ShortenBatch")
+	defer span.End()
+	span.SetAttributes(attribute.Int("items", len(items)), attribute.Bool("atomic", atomic))
+
+	if len(items) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	if len(items) > s.maxBatchSize {
+		return nil, fmt.Errorf("%w: at most %d items are allowed", ErrBatchTooLarge, s.maxBatchSize)
+	}
+	passwords := 0
+	for _, item := range items {
+		if item.Options.Password != "" {
+			passwords++
+		}
+	}
+	if passwords > s.maxBatchPasswords {
+		return nil, fmt.Errorf("%w: at most %d items with a password are allowed", ErrBatchTooLarge, s.maxBatchPasswords)
+	}
+
+	now := time.Now()
+	results := make([]BatchResult, len(items))
+	generated := make([]bool, len(items))
+	aliases := make(map[string]bool)
+	for i, item := range items {
+		longURL, err := s.checkDestination(ctx, item.LongURL)
+		var link *URLMapping
+		if err == nil {
+			item.Options.Rules, err = s.checkRules(ctx, item.Options.Rules)
+		}
+		if err == nil {
+			item.Options.Variants, err = s.checkVariants(ctx, item.Options.Variants)
+		}
+		if err == nil {
+			link, err = newLink(longURL, item.Options, now)
+		}
+		if err == nil && item.Options.ReuseExisting && link.ShortID == "" {
+			existing, err := s.findReusable(ctx, link)
+			if err == nil {
+				metrics.ShortenReused.Inc()
+				results[i] = BatchResult{Link: existing, Reused: true}
+				continue
+			}
+			if !errors.Is(err, repository.ErrNotFound) {
+				logger.Log.Warnf("Reusable link lookup error: %v", err)
+			}
+		}
+		if err == nil && link.ShortID != "" {
+			if aliases[link.ShortID] {
+				err = ErrAliasTaken
+			}
+			aliases[link.ShortID] = true
+		}
+		results[i] = BatchResult{Link: link, Err: err}
+		generated[i] = err == nil && link.ShortID == ""
+	}
+	if atomic && abortOnFailure(results) {
+		span.SetStatus(codes.Error, "invalid batch item")
+		return results, nil
+	}
+
+	stored := make([]bool, len(items))
+	for i := range results {
+		stored[i] = results[i].Reused
+	}
+	used := make(map[string]bool, len(items))
+	for id := range aliases {
+		used[id] = true
+	}
+	for attempt := 0; ; attempt++ {
+		var pending []int
+		for i := range results {
+			if results[i].Err == nil && !stored[i] {
+				pending = append(pending, i)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		links := make([]*URLMapping, len(pending))
+		for k, i := range pending {
+			if generated[i] && results[i].Link.ShortID == "" {
+				id, err := s.uniqueBatchID(ctx, results[i].Link.LongURL, used)
+				if err != nil {
+					span.SetStatus(codes.Error, "failed to generate short ID")
+					span.RecordError(err)
+					return nil, err
+				}
+				results[i].Link.ShortID = id
+			}
+			links[k] = results[i].Link
+		}
+
+		errs, err := s.createMany(ctx, links, atomic)
+		if errors.Is(err, ErrAtomicUnsupported) {
+			span.SetStatus(codes.Error, "atomic batches not supported")
+			return nil, err
+		}
+		if err != nil {
+			span.SetStatus(codes.Error, "failed to save batch")
+			span.RecordError(err)
+			logger.Log.Errorf("Batch insert error: %v", err)
+			return nil, errors.New("could not store in database")
+		}
+
+		retry, failed := false, false
+		for k, i := range pending {
+			switch {
+			case errs[k] == nil:
+				continue
+			case errors.Is(errs[k], repository.ErrDuplicate) && generated[i] && attempt < maxGenerateAttempts-1:
+				metrics.ShortIDCollisions.WithLabelValues(s.ids.Name()).Inc()
+				results[i].Link.ShortID = ""
+				retry = true
+			case errors.Is(errs[k], repository.ErrDuplicate) && generated[i]:
+				results[i].Err, failed = ErrIDExhausted, true
+			case errors.Is(errs[k], repository.ErrDuplicate):
+				results[i].Err, failed = ErrAliasTaken, true
+			default:
+				logger.Log.Errorf("Batch insert error on %s: %v", links[k].ShortID, errs[k])
+				results[i].Err, failed = errors.New("could not store in database"), true
+			}
+		}
+
+		if atomic {
+			// Nothing is stored unless every item succeeded.
+			if failed {
+				abortOnFailure(results)
+				span.SetStatus(codes.Error, "batch rolled back")
+				return results, nil
+			}
+			if retry {
+				continue
+			}
+		}
+		for k, i := range pending {
+			stored[i] = errs[k] == nil
+		}
+		if !retry {
+			break
+		}
+	}
+
+	for i := range results {
+		if results[i].Err != nil {
+			results[i].Link = nil
+		}
+	}
+	s.cacheLinks(ctx, results)
+	return results, nil
+}
+
+// abortOnFailure marks every successful result as aborted when any result
+// failed, and reports whether that happened.
+func abortOnFailure(results []BatchResult) bool {
+	failed := false
+	for _, r := range results {
+		if r.Err != nil {
+			failed = true
+			break
+		}
+	}
+	if !failed {
+		return false
+	}
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Err = ErrBatchAborted
+		}
+		results[i].Link = nil
+	}
+	return true
+}
+
+// uniqueBatchID generates an ID not already used by another item of the batch.
+func (s *Shortener) uniqueBatchID(ctx context.Context, longURL string, used map[string]bool) (string, error) {
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		id, err := s.ids.Generate(ctx, longURL)
+		if err != nil {
+			return "", err
+		}
+		if !used[id] {
+			used[id] = true
+			return id, nil
+		}
+	}
+	return "", ErrIDExhausted
+}
+
+// createMany uses the store's bulk insert when available, and otherwise
+// inserts one by one, deleting what was inserted if an atomic batch fails.
+func (s *Shortener) createMany(ctx context.Context, links []*URLMapping, atomic bool) ([]error, error) {
+	if bulk, ok := s.store.(repository.BulkCreator); ok {
+		return bulk.CreateMany(ctx, links, atomic)
+	}
+
+	errs := make([]error, len(links))
+	var inserted []string
+	for i, link := range links {
+		errs[i] = s.store.Create(ctx, link)
+		if errs[i] == nil {
+			inserted = append(inserted, link.ShortID)
+		} else if atomic {
+			break
+		}
+	}
+	if atomic && len(inserted) < len(links) {
+		for _, id := range inserted {
+			if err := s.store.Delete(ctx, id); err != nil {
+				return nil, fmt.Errorf("failed to roll back batch: %w", err)
+			}
+		}
+	}
+	return errs, nil
+}
+
+// cacheLinks writes the created links to the cache, pipelined when the cache
+// supports it.
+func (s *Shortener) cacheLinks(ctx context.Context, results []BatchResult) {
+	bulk, ok := s.cache.(repository.BulkCache)
+	if !ok {
+		for _, r := range results {
+			if r.Err == nil {
+				s.cacheLink(ctx, r.Link)
+			}
+		}
+		return
+	}
+
+	now := time.Now()
+	entries := make([]repository.CacheEntry, 0, len(results))
+	for _, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		expiry := cacheTTL(r.Link, now)
+		if expiry <= 0 {
+			continue
+		}
+		data, err := json.Marshal(r.Link)
+		if err != nil {
+			logger.Log.Warnf("Cache encode error: %v", err)
+			continue
+		}
+		entries = append(entries, repository.CacheEntry{Key: r.Link.ShortID, Value: string(data), TTL: expiry})
+	}
+	if len(entries) == 0 {
+		return
+	}
+	if err := bulk.SetMany(ctx, entries); err != nil {
+		logger.Log.Warnf("Redis pipeline error: %v", err)
+	}
+}
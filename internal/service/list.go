@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+
+	maxTags      = 10
+	maxTagLength = 32
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidQuery  = errors.New("invalid list query")
+)
+
+// normalizeTags lower-cases, trims and de-duplicates tags.
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidTags, maxTags)
+	}
+	var out []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || len(tag) > maxTagLength {
+			return nil, fmt.Errorf("%w: tags must have between 1 and %d characters", ErrInvalidTags, maxTagLength)
+		}
+		for _, r := range tag {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == ':') {
+				return nil, fmt.Errorf("%w: only letters, digits, '-', '_' and ':' are allowed", ErrInvalidTags)
+			}
+		}
+		if !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	return out, nil
+}
+
+// LinkQuery selects a page of links for ListLinks.
+type LinkQuery struct {
+	Filter repository.LinkFilter
+	Sort   string // repository.SortCreatedAt (default) or repository.SortAccessCount
+	Asc    bool
+	Limit  int
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+}
+
+// LinkPage is one page of ListLinks. NextCursor is empty on the last page.
+type LinkPage struct {
+	Links      []URLMapping `json:"links"`
+	Total      int64        `json:"total"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// listCursor is the opaque cursor handed to clients. It records the sort it
+// was issued for, so it cannot be replayed against a different ordering.
+type listCursor struct {
+	Sort        string    `json:"s"`
+	Asc         bool      `json:"a,omitempty"`
+	Created     time.Time `json:"c"`
+	AccessCount int       `json:"n"`
+	ShortID     string    `json:"i"`
+}
+
+func encodeCursor(q LinkQuery, last *URLMapping) string {
+	data, _ := json.Marshal(listCursor{
+		Sort:        q.Sort,
+		Asc:         q.Asc,
+		Created:     last.Created,
+		AccessCount: last.AccessCount,
+		ShortID:     last.ShortID,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(q LinkQuery) (*repository.ListCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ShortID == "" || c.Sort != q.Sort || c.Asc != q.Asc {
+		return nil, ErrInvalidCursor
+	}
+	return &repository.ListCursor{Created: c.Created, AccessCount: c.AccessCount, ShortID: c.ShortID}, nil
+}
+
+// ListLinks returns a page of links matching q. Non-admin callers only ever
+// see their own links.
+func (s *Shortener) ListLinks(ctx context.Context, q LinkQuery, caller Caller) (*LinkPage, error) {
+	ctx, span := tracer.Start(ctx, "ListLinks")
+	defer span.End()
+
+	if q.Sort == "" {
+		q.Sort = repository.SortCreatedAt
+	}
+	if q.Sort != repository.SortCreatedAt && q.Sort != repository.SortAccessCount {
+		return nil, fmt.Errorf("%w: sort must be created_at or access_count", ErrInvalidQuery)
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultListLimit
+	}
+	if q.Limit > MaxListLimit {
+		q.Limit = MaxListLimit
+	}
+	if !caller.Admin {
+		if caller.Owner == "" {
+			return nil, ErrForbidden
+		}
+		q.Filter.Owner = caller.Owner
+	}
+	q.Filter.Tag = strings.ToLower(q.Filter.Tag)
+
+	opts := repository.ListOptions{Filter: q.Filter, Sort: q.Sort, Asc: q.Asc, Limit: q.Limit + 1}
+	if q.Cursor != "" {
+		after, err := decodeCursor(q)
+		if err != nil {
+			span.SetStatus(codes.Error, "invalid cursor")
+			return nil, err
+		}
+		opts.After = after
+	}
+
+	links, err := s.store.List(ctx, opts)
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to list links")
+		span.RecordError(err)
+		logger.Log.Errorf("List error: %v", err)
+		return nil, errors.New("internal error")
+	}
+	total, err := s.store.Count(ctx, q.Filter)
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to count links")
+		span.RecordError(err)
+		logger.Log.Errorf("Count error: %v", err)
+		return nil, errors.New("internal error")
+	}
+
+	for i := range links {
+		links[i].PasswordHash = ""
+	}
+	page := &LinkPage{Links: links, Total: total}
+	if len(links) > q.Limit {
+		page.Links = links[:q.Limit]
+		page.NextCursor = encodeCursor(q, &page.Links[q.Limit-1])
+	}
+	return page, nil
+}
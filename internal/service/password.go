@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/ratelimit"
+	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 4
+	// maxPasswordLength is the longest input bcrypt accepts, in bytes.
+	maxPasswordLength = 72
+)
+
+// DefaultPasswordAttempts bounds the password attempts per link and visitor
+// unless overridden with WithPasswordAttemptLimit.
+var DefaultPasswordAttempts = ratelimit.Limit{Requests: 5, Window: 15 * time.Minute}
+
+var (
+	ErrInvalidPassword  = errors.New("invalid password")
+	ErrPasswordRequired = errors.New("short URL is password protected")
+	ErrWrongPassword    = errors.New("wrong password")
+	ErrTooManyAttempts  = errors.New("too many password attempts, try again later")
+)
+
+// WithPasswordAttemptLimit counts the password attempts of each visitor on a
+// link with limiter, allowing limit of them. Every link also accepts at most
+// ten times limit attempts overall, whoever makes them.
+func WithPasswordAttemptLimit(limiter ratelimit.Limiter, limit ratelimit.Limit) Option {
+	return func(s *Shortener) {
+		s.attempts, s.attemptLimit = limiter, limit
+	}
+}
+
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return "", fmt.Errorf("%w: must be between %d and %d bytes", ErrInvalidPassword, minPasswordLength, maxPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// redact returns a copy of link without its password hash, for API responses.
+func redact(link *URLMapping) *URLMapping {
+	cp := *link
+	cp.PasswordHash = ""
+	return &cp
+}
+
+// hideDestination returns a copy of link without anything that reveals where
+// it leads, for callers that may see a protected link's stats but not follow
+// it without the password.
+func hideDestination(link *URLMapping) *URLMapping {
+	cp := *link
+	cp.LongURL, cp.Domain, cp.NormalizedURL = "", "", ""
+	cp.History, cp.Rules, cp.Variants = nil, nil, nil
+	return &cp
+}
+
+// UnlockShortID resolves a password-protected short ID once password matches.
+// The IP of visit identifies who is guessing for the attempt limit. Links
+// without a password resolve as with ResolveShortID.
+func (s *Shortener) UnlockShortID(ctx context.Context, shortID, password string, visit Visit) (*Resolution, error) {
+	ctx, span := tracer.Start(ctx, "UnlockShortID")
+	defer span.End()
+
+	link, err := s.resolvable(ctx, shortID)
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to resolve short ID")
+		span.RecordError(err)
+		return nil, err
+	}
+	if link.Protected() {
+		if err := s.allowAttempt(ctx, shortID, visit.IP); err != nil {
+			span.SetStatus(codes.Error, "too many password attempts")
+			return nil, err
+		}
+		if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+			metrics.PasswordAttempts.WithLabelValues("wrong").Inc()
+			span.SetStatus(codes.Error, "wrong password")
+			return nil, ErrWrongPassword
+		}
+		metrics.PasswordAttempts.WithLabelValues("ok").Inc()
+	}
+	return s.count(ctx, span, link, visit)
+}
+
+// allowAttempt counts a password attempt against the visitor and the link.
+// Attempts are let through when the limiter fails.
+func (s *Shortener) allowAttempt(ctx context.Context, shortID, visitor string) error {
+	overall := ratelimit.Limit{Requests: 10 * s.attemptLimit.Requests, Window: s.attemptLimit.Window}
+	for _, check := range []struct {
+		key   string
+		limit ratelimit.Limit
+	}{
+		{"password:" + shortID + ":" + visitor, s.attemptLimit},
+		{"password:" + shortID, overall},
+	} {
+		res, err := s.attempts.Allow(ctx, check.key, check.limit)
+		if err != nil {
+			logger.Log.Warnf("Password attempt limiter error: %v", err)
+			return nil
+		}
+		if !res.Allowed {
+			metrics.PasswordAttempts.WithLabelValues("limited").Inc()
+			return ErrTooManyAttempts
+		}
+	}
+	return nil
+}
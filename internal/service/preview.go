@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// PreviewShortID returns the link behind shortID for the preview page without
+// counting a visit. Counters are read from the store rather than the cache,
+// and left out when the stats are private to others than caller.
+// The destination of a password-protected link is not disclosed:
+// ErrPasswordRequired is returned instead.
+func (s *Shortener) PreviewShortID(ctx context.Context, shortID string, caller Caller) (*URLMapping, error) {
+	ctx, span := tracer.Start(ctx, "PreviewShortID")
+	defer span.End()
+
+	link, err := s.store.Get(ctx, shortID)
+	if errors.Is(err, repository.ErrNotFound) {
+		span.SetStatus(codes.Error, "short URL not found")
+		return nil, ErrNotFound
+	} else if err != nil {
+		span.SetStatus(codes.Error, "failed to load link")
+		span.RecordError(err)
+		logger.Log.Errorf("Preview error: %v", err)
+		return nil, errors.New("internal error")
+	}
+	if err := s.checkFollowable(link); err != nil {
+		span.SetStatus(codes.Error, "short URL cannot be followed")
+		return nil, err
+	}
+	if link.Exhausted() {
+		span.SetStatus(codes.Error, "click limit reached")
+		return nil, ErrClickLimit
+	}
+	if link.Protected() {
+		span.SetStatus(codes.Error, "password required")
+		return nil, ErrPasswordRequired
+	}
+	return statsFor(redact(link), caller), nil
+}
+
+// statsFor returns link without its counters when caller may not read them.
+func statsFor(link *URLMapping, caller Caller) *URLMapping {
+	if caller.CanReadStats(link) {
+		return link
+	}
+	cp := *link
+	cp.AccessCount, cp.VariantClicks = 0, nil
+	return &cp
+}
+
+// LiveLink returns the link behind shortID if it can be followed right now:
+// it exists, has neither expired nor reached its click limit and does not
+// point to a blocked domain. No visit is counted.
+func (s *Shortener) LiveLink(ctx context.Context, shortID string) (*URLMapping, error) {
+	ctx, span := tracer.Start(ctx, "LiveLink")
+	defer span.End()
+
+	link, err := s.resolvable(ctx, shortID)
+	if err != nil {
+		span.SetStatus(codes.Error, "short URL cannot be followed")
+		return nil, err
+	}
+	if link.Exhausted() {
+		span.SetStatus(codes.Error, "click limit reached")
+		return nil, ErrClickLimit
+	}
+	return redact(link), nil
+}
@@ -2,32 +2,182 @@ package service
 
 import (
 	"context"
-	"crypto/sha1"
-	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/domainlist"
 	"github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
 	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/ratelimit"
 	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/shortid"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/urlnorm"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/urlpolicy"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/codes"
-
-	"github.com/redis/go-redis/v9"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var tracer = otel.Tracer("url-shortener/service")
 
 const (
-	shortIDLength = 8
-	ttl           = 24 * time.Hour
+	ttl = 24 * time.Hour
+
+	// maxGenerateAttempts bounds the retries after a generated ID collides.
+	maxGenerateAttempts = 5
+	// maxUpdateAttempts bounds the retries after a concurrent update.
+	maxUpdateAttempts = 3
+	// maxHistory caps the destinations kept in a link's version history.
+	maxHistory = 50
+)
+
+var (
+	ErrNotFound        = errors.New("short URL not found")
+	ErrInvalidAlias    = errors.New("invalid alias")
+	ErrAliasTaken      = errors.New("alias already in use")
+	ErrIDExhausted     = errors.New("could not generate a unique short ID")
+	ErrInvalidTTL      = errors.New("invalid expiration")
+	ErrExpired         = errors.New("short URL has expired")
+	ErrInvalidLimit    = errors.New("invalid max_clicks")
+	ErrClickLimit      = errors.New("short URL has reached its click limit")
+	ErrEmptyUpdate     = errors.New("no fields to update")
+	ErrConflict        = errors.New("link was modified concurrently, please retry")
+	ErrInvalidRedirect = errors.New("invalid redirect_type")
+	ErrForbidden       = errors.New("not allowed to manage this short URL")
+	ErrInvalidTags     = errors.New("invalid tags")
+	ErrBlocked         = errors.New("destination domain is blocked")
 )
 
-var urlPrefix = getURLPrefix()
+// BlockedError is returned when resolving a link whose destination matches a
+// block rule of the domain list.
+type BlockedError struct {
+	LongURL string
+	Rule    repository.DomainRule
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrBlocked, e.Rule.Domain)
+}
+
+func (e *BlockedError) Unwrap() error {
+	return ErrBlocked
+}
+
+// redirectTypes are the HTTP statuses a link may redirect with.
+var redirectTypes = map[int]bool{
+	http.StatusMovedPermanently:  true,
+	http.StatusFound:             true,
+	http.StatusTemporaryRedirect: true,
+	http.StatusPermanentRedirect: true,
+}
+
+// ValidRedirectType reports whether code is an accepted redirect status.
+func ValidRedirectType(code int) bool {
+	return redirectTypes[code]
+}
+
+func validateRedirectType(code int) error {
+	if code != 0 && !ValidRedirectType(code) {
+		return fmt.Errorf("%w: must be one of 301, 302, 307 or 308", ErrInvalidRedirect)
+	}
+	return nil
+}
+
+const (
+	minAliasLength = 3
+	maxAliasLength = 32
+)
+
+// reservedAliases collide with the routes registered in cmd/main.go.
+var reservedAliases = map[string]bool{
+	"stats":   true,
+	"links":   true,
+	"admin":   true,
+	"metrics": true,
+	"preview": true,
+	"short":   true,
+	"shorten": true,
+	"utm":     true,
+}
+
+// ShortenOptions carries the optional fields of a shorten request. At most one
+// of ExpiresAt and TTL may be set.
+type ShortenOptions struct {
+	Alias        string
+	ExpiresAt    *time.Time
+	TTL          time.Duration
+	MaxClicks    int
+	RedirectType int
+	// Owner is recorded on the link and is the only non-admin caller allowed
+	// to manage it.
+	Owner        string
+	PrivateStats bool
+	Tags         []string
+	// ReuseExisting returns the owner's existing, still usable link to the
+	// same normalized destination instead of creating a new one. It has no
+	// effect when an Alias or a Password is requested.
+	ReuseExisting bool
+	// Password, when set, must be entered by visitors before the redirect.
+	Password string
+	// Interstitial shows visitors the preview page on every visit.
+	Interstitial bool
+	// Rules send matching visitors to other destinations.
+	Rules []TargetRule
+	// Variants split the other visitors across destinations by weight.
+	Variants []Variant
+	// UTM is added to the query of the destination on every redirect.
+	UTM *UTM
+	// QueryPassthrough forwards the query of the short URL to the destination.
+	QueryPassthrough bool
+}
+
+// expiry resolves the absolute expiration requested by opts, if any.
+func (opts ShortenOptions) expiry(now time.Time) (*time.Time, error) {
+	switch {
+	case opts.ExpiresAt != nil && opts.TTL != 0:
+		return nil, fmt.Errorf("%w: expires_at and ttl_seconds are mutually exclusive", ErrInvalidTTL)
+	case opts.TTL < 0:
+		return nil, fmt.Errorf("%w: ttl_seconds must be positive", ErrInvalidTTL)
+	case opts.TTL > 0:
+		expiresAt := now.Add(opts.TTL)
+		return &expiresAt, nil
+	case opts.ExpiresAt != nil:
+		if !opts.ExpiresAt.After(now) {
+			return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidTTL)
+		}
+		expiresAt := opts.ExpiresAt.UTC()
+		return &expiresAt, nil
+	}
+	return nil, nil
+}
+
+type (
+	URLMapping        = repository.URLMapping
+	DestinationChange = repository.DestinationChange
+)
+
+// Caller is the authenticated principal acting on a link. The zero value is
+// an anonymous caller.
+type Caller struct {
+	Owner string
+	Admin bool
+}
+
+// canManage reports whether c may change link or read its private stats.
+func (c Caller) canManage(link *URLMapping) bool {
+	return c.Admin || (c.Owner != "" && c.Owner == link.Owner)
+}
+
+// CanReadStats reports whether c may see the counters of link.
+func (c Caller) CanReadStats(link *URLMapping) bool {
+	return !link.StatsPrivate || c.canManage(link)
+}
 
 func getURLPrefix() string {
 	if v := os.Getenv("URL_PREFIX"); v != "" {
@@ -36,161 +186,861 @@ func getURLPrefix() string {
 	return "http://localhost:8080/"
 }
 
-type URLMapping struct {
-	ShortID     string    `bson:"short_id" json:"short_id"`
-	LongURL     string    `bson:"long_url" json:"long_url"`
-	Created     time.Time `bson:"created_at" json:"created_at"`
-	AccessCount int       `bson:"access_count" json:"access_count"`
+// Shortener implements the link use cases on top of a LinkStore and a Cache.
+type Shortener struct {
+	store     repository.LinkStore
+	cache     repository.Cache
+	ids       shortid.Generator
+	urlPrefix string
+	// defaultRedirect applies to links without their own RedirectType.
+	defaultRedirect int
+	maxBatchSize    int
+	policy          *urlpolicy.Policy
+	domains         *domainlist.List
+	attempts        ratelimit.Limiter
+	attemptLimit    ratelimit.Limit
+	geo             CountryLocator
+	ownerUTM        OwnerTemplates
+
+	// maxBatchPasswords bounds the bcrypt work of one batch.
+	maxBatchPasswords int
+}
+
+type Option func(*Shortener)
+
+// WithURLPrefix overrides the URL_PREFIX used to build short URLs.
+func WithURLPrefix(prefix string) Option {
+	return func(s *Shortener) {
+		s.urlPrefix = prefix
+	}
+}
+
+// WithIDGenerator replaces the default random base62 generator.
+func WithIDGenerator(g shortid.Generator) Option {
+	return func(s *Shortener) {
+		s.ids = g
+	}
+}
+
+// WithDefaultRedirect sets the status used by links without a redirect_type.
+func WithDefaultRedirect(code int) Option {
+	return func(s *Shortener) {
+		if ValidRedirectType(code) {
+			s.defaultRedirect = code
+		}
+	}
+}
+
+// WithURLPolicy replaces the default destination policy. The host of the URL
+// prefix is always treated as a self-reference.
+func WithURLPolicy(p *urlpolicy.Policy) Option {
+	return func(s *Shortener) {
+		s.policy = p
+	}
+}
+
+// WithDomainList rejects destinations blocked by l when shortening and stops
+// redirecting existing links to them.
+func WithDomainList(l *domainlist.List) Option {
+	return func(s *Shortener) {
+		s.domains = l
+	}
+}
+
+// CountryLocator resolves the country of an IP address to an ISO code, or
+// "" when unknown. *geoip.DB implements it.
+type CountryLocator interface {
+	Country(ip string) string
+}
+
+// WithGeoIP resolves the country of visitors with l, for targeting rules and
+// click analytics.
+func WithGeoIP(l CountryLocator) Option {
+	return func(s *Shortener) {
+		s.geo = l
+	}
+}
+
+func NewShortener(store repository.LinkStore, cache repository.Cache, opts ...Option) *Shortener {
+	s := &Shortener{
+		store:     store,
+		cache:     cache,
+		ids:       shortid.NewRandomGenerator(shortid.DefaultLength),
+		urlPrefix: getURLPrefix(),
+
+		defaultRedirect: http.StatusMovedPermanently,
+		maxBatchSize:    DefaultMaxBatchSize,
+		policy:          urlpolicy.Default(),
+		attempts:        ratelimit.NewMemoryLimiter(),
+		attemptLimit:    DefaultPasswordAttempts,
+
+		maxBatchPasswords: DefaultMaxBatchPasswords,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if u, err := url.Parse(s.urlPrefix); err == nil && u.Hostname() != "" {
+		s.policy = s.policy.WithSelfHost(u.Hostname())
+	}
+	return s
+}
+
+// checkDestination applies the URL policy to longURL and returns it with an
+// ASCII host. Rejections are *urlpolicy.Error values.
+func (s *Shortener) checkDestination(ctx context.Context, longURL string) (string, error) {
+	checked, err := s.policy.Check(ctx, longURL)
+	if err == nil && s.domains != nil {
+		if rule, blocked := s.domains.Blocked(checked); blocked {
+			msg := fmt.Sprintf("domain %q is blocked", rule.Domain)
+			if rule.Reason != "" {
+				msg += ": " + rule.Reason
+			}
+			checked, err = "", urlpolicy.Reject(urlpolicy.CodeBlockedDomain, msg)
+		}
+	}
+	var perr *urlpolicy.Error
+	if errors.As(err, &perr) {
+		for _, v := range perr.Violations {
+			metrics.PolicyRejections.WithLabelValues(v.Code).Inc()
+		}
+	}
+	return checked, err
+}
+
+// checkNestedDestination applies checkDestination to a destination of part
+// of a link, such as a rule, naming the part in the violation messages.
+func (s *Shortener) checkNestedDestination(ctx context.Context, part, longURL string) (string, error) {
+	checked, err := s.checkDestination(ctx, longURL)
+	var perr *urlpolicy.Error
+	if !errors.As(err, &perr) {
+		return checked, err
+	}
+	violations := make([]urlpolicy.Violation, len(perr.Violations))
+	for i, v := range perr.Violations {
+		violations[i] = urlpolicy.Violation{Code: v.Code, Message: part + ": " + v.Message}
+	}
+	return "", &urlpolicy.Error{Violations: violations}
 }
 
-func generateShortID(longURL string) string {
-	hash := sha1.Sum([]byte(longURL + fmt.Sprint(time.Now().UnixNano())))
-	return base64.URLEncoding.EncodeToString(hash[:])[:shortIDLength]
+// validateAlias checks the charset, length and reserved words of a custom alias.
+func validateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return fmt.Errorf("%w: must be between %d and %d characters", ErrInvalidAlias, minAliasLength, maxAliasLength)
+	}
+	for _, r := range alias {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return fmt.Errorf("%w: only letters, digits, '-' and '_' are allowed", ErrInvalidAlias)
+		}
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidAlias, alias)
+	}
+	return nil
 }
 
-func ShortenURL(ctx context.Context, longURL string) (string, error) {
+// ShortURL builds the public short URL for shortID.
+func (s *Shortener) ShortURL(shortID string) string {
+	return s.urlPrefix + shortID
+}
+
+// newLink validates opts and builds the mapping to store for longURL. The
+// short ID is only set when an alias was requested.
+func newLink(longURL string, opts ShortenOptions, now time.Time) (*URLMapping, error) {
+	expiresAt, err := opts.expiry(now)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxClicks < 0 {
+		return nil, fmt.Errorf("%w: must be positive", ErrInvalidLimit)
+	}
+	if err := validateRedirectType(opts.RedirectType); err != nil {
+		return nil, err
+	}
+	tags, err := normalizeTags(opts.Tags)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Alias != "" {
+		if err := validateAlias(opts.Alias); err != nil {
+			return nil, err
+		}
+	}
+	passwordHash, err := hashPassword(opts.Password)
+	if err != nil {
+		return nil, err
+	}
+	utm, err := checkUTM(opts.UTM)
+	if err != nil {
+		return nil, err
+	}
+
+	return &URLMapping{
+		ShortID:       opts.Alias,
+		LongURL:       longURL,
+		Created:       now,
+		AccessCount:   0,
+		ExpiresAt:     expiresAt,
+		MaxClicks:     opts.MaxClicks,
+		RedirectType:  opts.RedirectType,
+		Owner:         opts.Owner,
+		StatsPrivate:  opts.PrivateStats,
+		Tags:          tags,
+		Domain:        repository.DestinationDomain(longURL),
+		NormalizedURL: normalizeURL(longURL),
+		PasswordHash:  passwordHash,
+		Interstitial:  opts.Interstitial,
+		Rules:         opts.Rules,
+		Variants:      opts.Variants,
+		UTM:           utm,
+
+		QueryPassthrough: opts.QueryPassthrough,
+	}, nil
+}
+
+// normalizeURL returns the canonical form of longURL, or "" when it cannot be
+// normalized, in which case the link is never reused.
+func normalizeURL(longURL string) string {
+	normalized, err := urlnorm.Normalize(longURL)
+	if err != nil {
+		return ""
+	}
+	return normalized
+}
+
+// findReusable looks up the link that doc may be replaced with under
+// ShortenOptions.ReuseExisting. Only a Reusable link is handed out, and only
+// in place of a Reusable one, so the link returned behaves exactly as the
+// one requested. The store skips the others, so an older match still counts
+// when a newer one has options.
+func (s *Shortener) findReusable(ctx context.Context, doc *URLMapping) (*URLMapping, error) {
+	if doc.NormalizedURL == "" || !doc.Reusable() {
+		return nil, repository.ErrNotFound
+	}
+	return s.store.FindReusable(ctx, doc.Owner, doc.NormalizedURL)
+}
+
+// ShortenURL creates a link for longURL and returns the stored mapping.
+// reused reports that an existing link was returned under
+// ShortenOptions.ReuseExisting.
+func (s *Shortener) ShortenURL(ctx context.Context, longURL string, opts ShortenOptions) (link *URLMapping, reused bool, err error) {
 	ctx, span := tracer.Start(ctx, "ShortenURL")
 	defer span.End()
 
-	shortID := generateShortID(longURL)
-	shortURL := urlPrefix + shortID
-	// Redis SET
-	start := time.Now()
-	err := repository.RedisClient.Set(ctx, shortID, longURL, ttl).Err()
-	metrics.RedisOpDuration.WithLabelValues("SET").Observe(time.Since(start).Seconds())
+	longURL, err = s.checkDestination(ctx, longURL)
 	if err != nil {
-		span.SetStatus(codes.Error, "failed to save mapping")
+		span.SetStatus(codes.Error, "destination rejected")
 		span.RecordError(err)
-		logger.Log.Errorf("Redis SET error: %v", err)
-		return "", errors.New("could not store in cache")
+		return nil, false, err
 	}
-
-	// Mongo INSERT
-	collection := repository.MongoClient.Database("shortener").Collection("urls")
-	doc := URLMapping{ShortID: shortID, LongURL: longURL, Created: time.Now(), AccessCount: 0}
-	start = time.Now()
-	_, err = collection.InsertOne(ctx, doc)
-	metrics.MongoOpDuration.WithLabelValues("InsertOne").Observe(time.Since(start).Seconds())
+	opts.Rules, err = s.checkRules(ctx, opts.Rules)
+	if err != nil {
+		span.SetStatus(codes.Error, "invalid targeting rules")
+		span.RecordError(err)
+		return nil, false, err
+	}
+	opts.Variants, err = s.checkVariants(ctx, opts.Variants)
+	if err != nil {
+		span.SetStatus(codes.Error, "invalid variants")
+		span.RecordError(err)
+		return nil, false, err
+	}
+	doc, err := newLink(longURL, opts, time.Now())
 	if err != nil {
+		span.SetStatus(codes.Error, "invalid shorten options")
+		span.RecordError(err)
+		return nil, false, err
+	}
+
+	if opts.ReuseExisting && opts.Alias == "" {
+		existing, err := s.findReusable(ctx, doc)
+		if err == nil {
+			metrics.ShortenReused.Inc()
+			return existing, true, nil
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			span.RecordError(err)
+			logger.Log.Warnf("Reusable link lookup error: %v", err)
+		}
+	}
+
+	if opts.Alias != "" {
+		err = s.store.Create(ctx, doc)
+		if errors.Is(err, repository.ErrDuplicate) {
+			span.SetStatus(codes.Error, "alias already in use")
+			span.RecordError(err)
+			return nil, false, ErrAliasTaken
+		}
+	} else {
+		err = s.createWithGeneratedID(ctx, doc)
+	}
+	if errors.Is(err, ErrIDExhausted) {
+		span.SetStatus(codes.Error, "failed to generate short ID")
+		span.RecordError(err)
+		logger.Log.Errorf("Short ID generation error: %v", err)
+		return nil, false, err
+	} else if err != nil {
 		span.SetStatus(codes.Error, "failed to save mapping")
 		span.RecordError(err)
 		logger.Log.Errorf("Mongo Insert error: %v", err)
-		return "", errors.New("could not store in database")
+		return nil, false, errors.New("could not store in database")
 	}
 
-	return shortURL, nil
+	// Cache SET. The store is written first so that a taken ID never
+	// overwrites the cached destination of the existing link.
+	s.cacheLink(ctx, doc)
+
+	return doc, false, nil
 }
 
-func ResolveShortID(ctx context.Context, shortID string) (string, error) {
-	ctx, span := tracer.Start(ctx, "ResolveShortID")
-	defer span.End()
-	// Redis GET
-	start := time.Now()
-	longURL, err := repository.RedisClient.Get(ctx, shortID).Result()
-	metrics.RedisOpDuration.WithLabelValues("GET").Observe(time.Since(start).Seconds())
+// createWithGeneratedID inserts doc under a freshly generated ID, retrying
+// with a new candidate whenever the store reports a collision.
+func (s *Shortener) createWithGeneratedID(ctx context.Context, doc *URLMapping) error {
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		shortID, err := s.ids.Generate(ctx, doc.LongURL)
+		if err != nil {
+			return err
+		}
+		doc.ShortID = shortID
+		err = s.store.Create(ctx, doc)
+		if !errors.Is(err, repository.ErrDuplicate) {
+			return err
+		}
+		metrics.ShortIDCollisions.WithLabelValues(s.ids.Name()).Inc()
+		logger.Log.Warnf("Short ID collision on %s (attempt %d)", shortID, attempt+1)
+	}
+	return ErrIDExhausted
+}
 
-	if err == nil {
-		metrics.RedisCacheHits.Inc()
-		incrementAccessCount(ctx, shortID)
-		metrics.RedirectCounter.Inc()
-		return longURL, nil
+// cacheTTL never lets a cache entry outlive the link's own expiry.
+func cacheTTL(link *URLMapping, now time.Time) time.Duration {
+	if link.ExpiresAt != nil {
+		if remaining := link.ExpiresAt.Sub(now); remaining < ttl {
+			return remaining
+		}
 	}
-	if err != redis.Nil {
-		span.SetStatus(codes.Error, "failed to resolve short ID")
+	return ttl
+}
+
+// cacheLink stores the mapping as JSON so that expiry and the other per-link
+// settings are enforced on cache hits too.
+func (s *Shortener) cacheLink(ctx context.Context, link *URLMapping) {
+	expiry := cacheTTL(link, time.Now())
+	if expiry <= 0 {
+		return
+	}
+	data, err := json.Marshal(link)
+	if err != nil {
+		logger.Log.Warnf("Cache encode error: %v", err)
+		return
+	}
+	if err := s.cache.Set(ctx, link.ShortID, string(data), expiry); err != nil {
+		logger.Log.Warnf("Redis SET error: %v", err)
+	}
+}
+
+// lookup returns the link from the cache, falling back to the store and
+// re-populating the cache on a miss.
+func (s *Shortener) lookup(ctx context.Context, shortID string) (*URLMapping, error) {
+	ctx, span := tracer.Start(ctx, "lookup")
+	defer span.End()
+	// Cache GET
+	cached, err := s.cache.Get(ctx, shortID)
+	if err == nil {
+		var link URLMapping
+		if jsonErr := json.Unmarshal([]byte(cached), &link); jsonErr == nil {
+			metrics.RedisCacheHits.Inc()
+			return &link, nil
+		}
+		// Entries written before the cache held JSON are treated as misses.
+	} else if !errors.Is(err, repository.ErrCacheMiss) {
 		span.RecordError(err)
 		logger.Log.Warnf("Redis error: %v", err)
 	}
 	metrics.RedisCacheMisses.Inc()
 
-	// Mongo fallback
-	collection := repository.MongoClient.Database("shortener").Collection("urls")
-	var result URLMapping
-	start = time.Now()
-	err = collection.FindOneAndUpdate(
-		ctx,
-		bson.M{"short_id": shortID},
-		bson.M{"$inc": bson.M{"access_count": 1}},
-	).Decode(&result)
-	metrics.MongoOpDuration.WithLabelValues("FindOneAndUpdate").Observe(time.Since(start).Seconds())
-
-	if err == mongo.ErrNoDocuments {
+	// Store fallback
+	link, err := s.store.Get(ctx, shortID)
+	if errors.Is(err, repository.ErrNotFound) {
 		span.SetStatus(codes.Error, "short URL not found")
 		span.RecordError(err)
-		return "", errors.New("short URL not found")
+		return nil, ErrNotFound
 	} else if err != nil {
 		span.SetStatus(codes.Error, "failed to resolve short ID")
 		span.RecordError(err)
 		logger.Log.Errorf("Mongo error: %v", err)
-		return "", errors.New("internal error")
+		return nil, errors.New("internal error")
 	}
 
 	// Reescreve no cache
-	start = time.Now()
-	_ = repository.RedisClient.Set(ctx, shortID, result.LongURL, ttl).Err()
-	metrics.RedisOpDuration.WithLabelValues("SET").Observe(time.Since(start).Seconds())
+	s.cacheLink(ctx, link)
 
-	return result.LongURL, nil
+	return link, nil
 }
 
-func GetURLStats(ctx context.Context, shortID string) (*URLMapping, error) {
+// Resolution is the outcome of resolving a short ID for a visitor.
+type Resolution struct {
+	Link       *URLMapping
+	LongURL    string
+	StatusCode int
+	// Interstitial means the visitor must be shown the preview page, with
+	// LongURL as the destination; the visit has not been counted.
+	Interstitial bool
+	// Variant is the ID of the variant the visitor was sent to, if any.
+	Variant string
+	// Country is the visitor's country, when known.
+	Country string
+	// OwnerUTM reports that the owner's UTM template was merged into LongURL.
+	OwnerUTM bool
+}
+
+// ResolveShortID resolves shortID for visit and counts the click. The
+// destination is that of the first targeting rule matching visit, else that
+// of a variant, else the link's own, with the UTM templates and forwarded
+// query merged in.
+// Password-protected links fail with ErrPasswordRequired; see UnlockShortID.
+func (s *Shortener) ResolveShortID(ctx context.Context, shortID string, visit Visit) (*Resolution, error) {
+	ctx, span := tracer.Start(ctx, "ResolveShortID")
+	defer span.End()
+
+	link, err := s.resolvable(ctx, shortID)
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to resolve short ID")
+		span.RecordError(err)
+		return nil, err
+	}
+	if link.Protected() {
+		span.SetStatus(codes.Error, "password required")
+		return nil, ErrPasswordRequired
+	}
+	if link.Interstitial {
+		res, err := s.route(span, statsFor(redact(link), Caller{}), visit)
+		if err != nil {
+			return nil, err
+		}
+		res.Interstitial = true
+		return res, nil
+	}
+	return s.count(ctx, span, link, visit)
+}
+
+// resolvable looks up shortID, from the cache when possible, and checks that
+// the link may still be followed.
+func (s *Shortener) resolvable(ctx context.Context, shortID string) (*URLMapping, error) {
+	link, err := s.lookup(ctx, shortID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkFollowable(link); err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// checkFollowable fails when link has expired or points to a blocked domain.
+func (s *Shortener) checkFollowable(link *URLMapping) error {
+	if link.Expired(time.Now()) {
+		return ErrExpired
+	}
+	return s.checkBlocked(link.LongURL)
+}
+
+// checkBlocked fails with a *BlockedError when longURL is on the domain list.
+func (s *Shortener) checkBlocked(longURL string) error {
+	if s.domains != nil {
+		if rule, blocked := s.domains.Blocked(longURL); blocked {
+			metrics.BlockedRedirects.Inc()
+			return &BlockedError{LongURL: longURL, Rule: rule}
+		}
+	}
+	return nil
+}
+
+// route works out where link sends the visitor, without counting the visit.
+func (s *Shortener) route(span trace.Span, link *URLMapping, visit Visit) (*Resolution, error) {
+	if visit.Country == "" && s.geo != nil {
+		visit.Country = s.geo.Country(visit.IP)
+	}
+	longURL, variant := destination(link, visit)
+	if longURL != link.LongURL {
+		if err := s.checkBlocked(longURL); err != nil {
+			span.SetStatus(codes.Error, "destination domain is blocked")
+			return nil, err
+		}
+	}
+	res := s.resolution(link)
+	res.LongURL, res.OwnerUTM = s.withParams(link, longURL, variant, visit)
+	res.Variant, res.Country = variant, visit.Country
+	return res, nil
+}
+
+// count records a visit of link and returns where to send the visitor.
+func (s *Shortener) count(ctx context.Context, span trace.Span, link *URLMapping, visit Visit) (*Resolution, error) {
+	res, err := s.route(span, link, visit)
+	if err != nil {
+		return nil, err
+	}
+	if link.MaxClicks > 0 {
+		// Click-limited links are counted synchronously: the store only
+		// increments below the limit, which holds across replicas.
+		if _, err := s.store.IncrementAccessCount(ctx, link.ShortID); err != nil {
+			return nil, s.countError(span, err)
+		}
+	} else {
+		s.incrementAccessCount(ctx, link.ShortID)
+	}
+	if res.Variant != "" {
+		if err := s.store.IncrementVariantCount(ctx, link.ShortID, res.Variant); err != nil {
+			span.RecordError(err)
+			logger.Log.Warnf("Variant count error: %v", err)
+		}
+	}
+	return res, nil
+}
+
+func (s *Shortener) resolution(link *URLMapping) *Resolution {
+	status := link.RedirectType
+	if status == 0 {
+		status = s.defaultRedirect
+	}
+	return &Resolution{Link: link, LongURL: link.LongURL, StatusCode: status}
+}
+
+// countError maps a failed click-limited increment to a service error.
+func (s *Shortener) countError(span trace.Span, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrExhausted):
+		span.SetStatus(codes.Error, "click limit reached")
+		span.RecordError(err)
+		return ErrClickLimit
+	case errors.Is(err, repository.ErrNotFound):
+		span.SetStatus(codes.Error, "short URL not found")
+		span.RecordError(err)
+		return ErrNotFound
+	default:
+		span.SetStatus(codes.Error, "failed to count access")
+		span.RecordError(err)
+		logger.Log.Errorf("Mongo error: %v", err)
+		return errors.New("internal error")
+	}
+}
+
+// GetURLStats returns the link with its counters. Links with private stats
+// are only visible to callers that can manage them, and the destination of a
+// password-protected link is left out for everyone else.
+func (s *Shortener) GetURLStats(ctx context.Context, shortID string, caller Caller) (*URLMapping, error) {
 	ctx, span := tracer.Start(ctx, "GetURLStats")
 	defer span.End()
-	collection := repository.MongoClient.Database("shortener").Collection("urls")
-	var result URLMapping
-	err := collection.FindOne(ctx, bson.M{"short_id": shortID}).Decode(&result)
-	if err == mongo.ErrNoDocuments {
+	result, err := s.store.Get(ctx, shortID)
+	if errors.Is(err, repository.ErrNotFound) {
 		span.SetStatus(codes.Error, "short URL not found")
 		span.RecordError(err)
-		return nil, errors.New("short URL not found")
+		return nil, ErrNotFound
 	} else if err != nil {
 		span.SetStatus(codes.Error, "failed to get URL stats")
 		span.RecordError(err)
 		logger.Log.Errorf("Stats error: %v", err)
 		return nil, errors.New("internal error")
 	}
-	return &result, nil
+	if !caller.CanReadStats(result) {
+		span.SetStatus(codes.Error, "stats are private")
+		return nil, ErrForbidden
+	}
+	if result.Protected() && !caller.canManage(result) {
+		return hideDestination(redact(result)), nil
+	}
+	return redact(result), nil
 }
 
-func incrementAccessCount(ctx context.Context, shortID string) {
+func (s *Shortener) incrementAccessCount(ctx context.Context, shortID string) {
 	ctx, span := tracer.Start(ctx, "incrementAccessCount")
 	defer span.End()
-	collection := repository.MongoClient.Database("shortener").Collection("urls")
-	_, _ = collection.UpdateOne(
-		ctx,
-		bson.M{"short_id": shortID},
-		bson.M{"$inc": bson.M{"access_count": 1}},
-	)
+	_, _ = s.store.IncrementAccessCount(ctx, shortID)
 }
 
-func DeleteShortID(ctx context.Context, shortID string) error {
+func (s *Shortener) DeleteShortID(ctx context.Context, shortID string, caller Caller) error {
 	ctx, span := tracer.Start(ctx, "DeleteShortID")
 	defer span.End()
-	// Redis DEL
-	start := time.Now()
-	err := repository.RedisClient.Del(ctx, shortID).Err()
-	metrics.RedisOpDuration.WithLabelValues("DEL").Observe(time.Since(start).Seconds())
-	if err != nil && err != redis.Nil {
+
+	link, err := s.store.Get(ctx, shortID)
+	if errors.Is(err, repository.ErrNotFound) {
+		span.SetStatus(codes.Error, "short URL not found")
+		span.RecordError(err)
+		return ErrNotFound
+	} else if err != nil {
+		span.SetStatus(codes.Error, "failed to load link")
+		span.RecordError(err)
+		logger.Log.Errorf("Mongo error: %v", err)
+		return errors.New("internal error")
+	}
+	if !caller.canManage(link) {
+		span.SetStatus(codes.Error, "caller does not own the link")
+		return ErrForbidden
+	}
+
+	// Cache DEL
+	err = s.cache.Delete(ctx, shortID)
+	if err != nil {
 		span.SetStatus(codes.Error, "failed to delete from cache")
 		span.RecordError(err)
 		logger.Log.Warnf("Redis DEL error: %v", err)
 	}
 
-	// Mongo DELETE
-	collection := repository.MongoClient.Database("shortener").Collection("urls")
-	start = time.Now()
-	res, err := collection.DeleteOne(ctx, bson.M{"short_id": shortID})
-	metrics.MongoOpDuration.WithLabelValues("DeleteOne").Observe(time.Since(start).Seconds())
-	if err != nil {
+	// Store DELETE
+	err = s.store.Delete(ctx, shortID)
+	if errors.Is(err, repository.ErrNotFound) {
+		span.SetStatus(codes.Error, "short URL not found")
+		span.RecordError(err)
+		return ErrNotFound
+	} else if err != nil {
 		span.SetStatus(codes.Error, "failed to delete from database")
 		span.RecordError(err)
 		logger.Log.Errorf("Mongo Delete error: %v", err)
 		return errors.New("failed to delete from database")
 	}
-	if res.DeletedCount == 0 {
-		span.SetStatus(codes.Error, "short URL not found")
-		span.RecordError(errors.New("short URL not found"))
-		return errors.New("short URL not found")
-	}
 
 	return nil
 }
+
+// LinkUpdate lists the mutable fields of a link; nil fields are left as is.
+type LinkUpdate struct {
+	LongURL      *string
+	ExpiresAt    *time.Time
+	TTL          *time.Duration
+	ClearExpiry  bool
+	MaxClicks    *int
+	RedirectType *int
+	StatsPrivate *bool
+	// Tags replaces the link's tags; an empty slice removes them all.
+	Tags *[]string
+	// Password replaces the link's password; an empty one removes it.
+	Password     *string
+	Interstitial *bool
+	// Rules replaces the link's targeting rules; an empty slice removes them.
+	Rules *[]TargetRule
+	// Variants replaces the link's variants; an empty slice removes them.
+	// Click counts of variant IDs that are kept carry over.
+	Variants *[]Variant
+	// UTM replaces the link's template; an empty one removes it.
+	UTM              *UTM
+	QueryPassthrough *bool
+
+	// passwordHash is the hash of Password, computed once by UpdateLink.
+	passwordHash string
+}
+
+func (u LinkUpdate) empty() bool {
+	return u.LongURL == nil && u.ExpiresAt == nil && u.TTL == nil && !u.ClearExpiry &&
+		u.MaxClicks == nil && u.RedirectType == nil && u.StatsPrivate == nil && u.Tags == nil &&
+		u.Password == nil && u.Interstitial == nil && u.Rules == nil &&
+		u.Variants == nil && u.UTM == nil && u.QueryPassthrough == nil
+}
+
+// apply validates the update and writes it into link, recording the replaced
+// destination in the link's history.
+func (u LinkUpdate) apply(link *URLMapping, now time.Time) error {
+	if u.empty() {
+		return ErrEmptyUpdate
+	}
+	if u.ClearExpiry && (u.ExpiresAt != nil || u.TTL != nil) {
+		return fmt.Errorf("%w: clear_expiry cannot be combined with a new expiration", ErrInvalidTTL)
+	}
+	if u.ExpiresAt != nil || u.TTL != nil {
+		opts := ShortenOptions{ExpiresAt: u.ExpiresAt}
+		if u.TTL != nil {
+			if *u.TTL <= 0 {
+				return fmt.Errorf("%w: ttl_seconds must be positive", ErrInvalidTTL)
+			}
+			opts.TTL = *u.TTL
+		}
+		expiresAt, err := opts.expiry(now)
+		if err != nil {
+			return err
+		}
+		link.ExpiresAt = expiresAt
+	}
+	if u.ClearExpiry {
+		link.ExpiresAt = nil
+	}
+	if u.MaxClicks != nil {
+		if *u.MaxClicks < 0 {
+			return fmt.Errorf("%w: must be positive", ErrInvalidLimit)
+		}
+		link.MaxClicks = *u.MaxClicks
+	}
+	if u.RedirectType != nil {
+		if err := validateRedirectType(*u.RedirectType); err != nil {
+			return err
+		}
+		link.RedirectType = *u.RedirectType
+	}
+	if u.StatsPrivate != nil {
+		link.StatsPrivate = *u.StatsPrivate
+	}
+	if u.Password != nil {
+		link.PasswordHash = u.passwordHash
+	}
+	if u.Interstitial != nil {
+		link.Interstitial = *u.Interstitial
+	}
+	if u.Rules != nil {
+		link.Rules = *u.Rules
+	}
+	if u.Variants != nil {
+		link.Variants = *u.Variants
+	}
+	if u.UTM != nil {
+		utm, err := checkUTM(u.UTM)
+		if err != nil {
+			return err
+		}
+		link.UTM = utm
+	}
+	if u.QueryPassthrough != nil {
+		link.QueryPassthrough = *u.QueryPassthrough
+	}
+	if u.Tags != nil {
+		tags, err := normalizeTags(*u.Tags)
+		if err != nil {
+			return err
+		}
+		link.Tags = tags
+	}
+	if u.LongURL != nil && *u.LongURL != link.LongURL {
+		link.History = append(link.History, DestinationChange{LongURL: link.LongURL, ReplacedAt: now})
+		if len(link.History) > maxHistory {
+			link.History = link.History[len(link.History)-maxHistory:]
+		}
+		link.LongURL = *u.LongURL
+		link.Domain = repository.DestinationDomain(link.LongURL)
+		link.NormalizedURL = normalizeURL(link.LongURL)
+	}
+	return nil
+}
+
+// UpdateLink changes the destination and other mutable fields of a link and
+// rewrites its cache entry. Concurrent updates are retried on a fresh copy.
+func (s *Shortener) UpdateLink(ctx context.Context, shortID string, upd LinkUpdate, caller Caller) (*URLMapping, error) {
+	ctx, span := tracer.Start(ctx, "UpdateLink")
+	defer span.End()
+
+	if upd.Password != nil {
+		hash, err := hashPassword(*upd.Password)
+		if err != nil {
+			span.SetStatus(codes.Error, "invalid password")
+			return nil, err
+		}
+		upd.passwordHash = hash
+	}
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		link, err := s.store.Get(ctx, shortID)
+		if errors.Is(err, repository.ErrNotFound) {
+			span.SetStatus(codes.Error, "short URL not found")
+			span.RecordError(err)
+			return nil, ErrNotFound
+		} else if err != nil {
+			span.SetStatus(codes.Error, "failed to load link")
+			span.RecordError(err)
+			logger.Log.Errorf("Mongo error: %v", err)
+			return nil, errors.New("internal error")
+		}
+		if !caller.canManage(link) {
+			span.SetStatus(codes.Error, "caller does not own the link")
+			return nil, ErrForbidden
+		}
+		if upd.LongURL != nil && attempt == 0 {
+			checked, err := s.checkDestination(ctx, *upd.LongURL)
+			if err != nil {
+				span.SetStatus(codes.Error, "destination rejected")
+				span.RecordError(err)
+				return nil, err
+			}
+			upd.LongURL = &checked
+		}
+		if upd.Rules != nil && attempt == 0 {
+			rules, err := s.checkRules(ctx, *upd.Rules)
+			if err != nil {
+				span.SetStatus(codes.Error, "invalid targeting rules")
+				span.RecordError(err)
+				return nil, err
+			}
+			upd.Rules = &rules
+		}
+		if upd.Variants != nil && attempt == 0 {
+			variants, err := s.checkVariants(ctx, *upd.Variants)
+			if err != nil {
+				span.SetStatus(codes.Error, "invalid variants")
+				span.RecordError(err)
+				return nil, err
+			}
+			upd.Variants = &variants
+		}
+
+		if err := upd.apply(link, time.Now()); err != nil {
+			span.SetStatus(codes.Error, "invalid update")
+			span.RecordError(err)
+			return nil, err
+		}
+
+		err = s.store.Update(ctx, link)
+		if errors.Is(err, repository.ErrConflict) {
+			logger.Log.Warnf("Concurrent update on %s (attempt %d)", shortID, attempt+1)
+			continue
+		} else if errors.Is(err, repository.ErrNotFound) {
+			span.SetStatus(codes.Error, "short URL not found")
+			span.RecordError(err)
+			return nil, ErrNotFound
+		} else if err != nil {
+			span.SetStatus(codes.Error, "failed to update link")
+			span.RecordError(err)
+			logger.Log.Errorf("Mongo Update error: %v", err)
+			return nil, errors.New("failed to update link")
+		}
+
+		s.refreshCache(ctx, link)
+		return redact(link), nil
+	}
+
+	span.SetStatus(codes.Error, "concurrent update")
+	return nil, ErrConflict
+}
+
+// refreshCache drops the cached entry of link and writes the current version.
+func (s *Shortener) refreshCache(ctx context.Context, link *URLMapping) {
+	if err := s.cache.Delete(ctx, link.ShortID); err != nil {
+		logger.Log.Warnf("Redis DEL error: %v", err)
+	}
+	s.cacheLink(ctx, link)
+}
+
+// PurgeExpired removes expired links from stores that do not expire them on
+// their own.
+func (s *Shortener) PurgeExpired(ctx context.Context) (int64, error) {
+	purger, ok := s.store.(repository.ExpiredPurger)
+	if !ok {
+		return 0, nil
+	}
+	return purger.DeleteExpired(ctx, time.Now())
+}
+
+// RunExpirySweeper calls PurgeExpired every interval until ctx is done.
+func (s *Shortener) RunExpirySweeper(ctx context.Context, interval time.Duration) {
+	if _, ok := s.store.(repository.ExpiredPurger); !ok {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.PurgeExpired(ctx)
+			if err != nil {
+				logger.Log.Errorf("Expiry sweep error: %v", err)
+			} else if n > 0 {
+				logger.Log.Infof("Expiry sweep removed %d links", n)
+			}
+		}
+	}
+}
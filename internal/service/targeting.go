@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/analytics"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+)
+
+type TargetRule = repository.TargetRule
+
+// MaxRules caps the targeting rules of a link.
+const MaxRules = 20
+
+var ErrInvalidRules = errors.New("invalid targeting rules")
+
+// platforms are the values accepted in TargetRule.Platforms.
+var platforms = map[string]bool{
+	"ios": true, "android": true, "windows": true, "macos": true, "linux": true, "chromeos": true,
+	analytics.DeviceMobile: true, analytics.DeviceTablet: true, analytics.DeviceDesktop: true, analytics.DeviceBot: true,
+}
+
+// Visit describes the request following a short link.
+type Visit struct {
+	IP             string
+	UserAgent      string
+	AcceptLanguage string
+	// Variant is the variant the visitor was assigned on an earlier visit.
+	Variant string
+	// Country is the ISO code of the visitor's country. When empty, it is
+	// looked up from IP in the GeoIP database, if one is configured.
+	Country string
+	// Query is the raw query string of the short URL, forwarded to links
+	// with QueryPassthrough.
+	Query string
+	// Time is when the visit happened; zero means now.
+	Time time.Time
+}
+
+// visitor is a Visit with its headers parsed, built once per resolution.
+type visitor struct {
+	os, device string
+	language   string
+	country    string
+	time       time.Time
+}
+
+func newVisitor(v Visit) visitor {
+	agent := analytics.ParseUserAgent(v.UserAgent)
+	t := v.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return visitor{
+		os:       strings.ToLower(agent.OS),
+		device:   agent.Device,
+		language: preferredLanguage(v.AcceptLanguage),
+		country:  v.Country,
+		time:     t,
+	}
+}
+
+// preferredLanguage returns the lower-cased tag with the highest quality in
+// an Accept-Language header, the first one on a tie, or "".
+func preferredLanguage(header string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			langs = append(langs, weighted{tag, q})
+		}
+	}
+	if len(langs) == 0 {
+		return ""
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	return langs[0].tag
+}
+
+func (v visitor) matches(r TargetRule) bool {
+	if len(r.Platforms) > 0 && !contains(r.Platforms, v.os) && !contains(r.Platforms, v.device) {
+		return false
+	}
+	if len(r.Languages) > 0 {
+		ok := false
+		for _, lang := range r.Languages {
+			if v.language == lang || strings.HasPrefix(v.language, lang+"-") {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(r.Countries) > 0 && !contains(r.Countries, v.country) {
+		return false
+	}
+	if r.From != nil && v.time.Before(*r.From) {
+		return false
+	}
+	if r.Until != nil && !v.time.Before(*r.Until) {
+		return false
+	}
+	return true
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRule returns the destination of the first rule of link matching visit.
+func matchRule(link *URLMapping, visit Visit) (string, bool) {
+	if len(link.Rules) == 0 {
+		return "", false
+	}
+	v := newVisitor(visit)
+	for _, r := range link.Rules {
+		if v.matches(r) {
+			metrics.TargetingMatches.WithLabelValues("rule").Inc()
+			return r.LongURL, true
+		}
+	}
+	metrics.TargetingMatches.WithLabelValues("default").Inc()
+	return "", false
+}
+
+// destination returns where to send visit: to the first matching rule, else
+// to a variant, whose ID is returned too, else to the link's own URL.
+func destination(link *URLMapping, visit Visit) (longURL, variant string) {
+	if longURL, ok := matchRule(link, visit); ok {
+		return longURL, ""
+	}
+	if v, ok := pickVariant(link.Variants, visit.Variant); ok {
+		return v.LongURL, v.ID
+	}
+	return link.LongURL, ""
+}
+
+// checkRules validates rules and normalizes their conditions, and applies the
+// destination checks to the URL of every rule.
+func (s *Shortener) checkRules(ctx context.Context, rules []TargetRule) ([]TargetRule, error) {
+	if len(rules) > MaxRules {
+		return nil, fmt.Errorf("%w: at most %d rules are allowed", ErrInvalidRules, MaxRules)
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	checked := make([]TargetRule, len(rules))
+	for i, r := range rules {
+		if len(r.Platforms) == 0 && len(r.Languages) == 0 && len(r.Countries) == 0 && r.From == nil && r.Until == nil {
+			return nil, fmt.Errorf("%w: rule %d has no condition", ErrInvalidRules, i)
+		}
+		out := TargetRule{From: utcTime(r.From), Until: utcTime(r.Until)}
+		if out.From != nil && out.Until != nil && !out.Until.After(*out.From) {
+			return nil, fmt.Errorf("%w: rule %d ends before it starts", ErrInvalidRules, i)
+		}
+		for _, p := range r.Platforms {
+			p = strings.ToLower(strings.TrimSpace(p))
+			if !platforms[p] {
+				return nil, fmt.Errorf("%w: rule %d has unknown platform %q", ErrInvalidRules, i, p)
+			}
+			out.Platforms = append(out.Platforms, p)
+		}
+		for _, lang := range r.Languages {
+			lang = strings.ToLower(strings.TrimSpace(lang))
+			if !validLanguage(lang) {
+				return nil, fmt.Errorf("%w: rule %d has invalid language %q", ErrInvalidRules, i, lang)
+			}
+			out.Languages = append(out.Languages, lang)
+		}
+		for _, country := range r.Countries {
+			country = strings.ToUpper(strings.TrimSpace(country))
+			if !validCountry(country) {
+				return nil, fmt.Errorf("%w: rule %d has invalid country %q", ErrInvalidRules, i, country)
+			}
+			out.Countries = append(out.Countries, country)
+		}
+		longURL, err := s.checkNestedDestination(ctx, fmt.Sprintf("rule %d", i), r.LongURL)
+		if err != nil {
+			return nil, err
+		}
+		out.LongURL = longURL
+		checked[i] = out
+	}
+	return checked, nil
+}
+
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// validCountry accepts ISO 3166-1 alpha-2 codes in upper case.
+func validCountry(code string) bool {
+	return len(code) == 2 && code[0] >= 'A' && code[0] <= 'Z' && code[1] >= 'A' && code[1] <= 'Z'
+}
+
+// validLanguage accepts language tags such as "pt" or "pt-br": subtags of
+// one to eight letters or digits, the first made of letters.
+func validLanguage(tag string) bool {
+	for i, sub := range strings.Split(tag, "-") {
+		if len(sub) == 0 || len(sub) > 8 {
+			return false
+		}
+		for _, r := range sub {
+			if !(r >= 'a' && r <= 'z' || i > 0 && r >= '0' && r <= '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/utm"
+)
+
+type UTM = repository.UTM
+
+var ErrInvalidUTM = utm.ErrInvalidTemplate
+
+// OwnerTemplates provides the UTM template of an owner. *utm.Templates
+// implements it.
+type OwnerTemplates interface {
+	OwnerUTM(owner string) (UTM, bool)
+}
+
+// WithOwnerUTM adds the template of the link's owner to every destination,
+// below the link's own template.
+func WithOwnerUTM(t OwnerTemplates) Option {
+	return func(s *Shortener) {
+		s.ownerUTM = t
+	}
+}
+
+// checkUTM validates a link template; an empty one is dropped.
+func checkUTM(t *UTM) (*UTM, error) {
+	if t == nil {
+		return nil, nil
+	}
+	checked, err := utm.Check(*t)
+	if err != nil || checked == (UTM{}) {
+		return nil, err
+	}
+	return &checked, nil
+}
+
+// withParams adds to longURL the query of visit, when link forwards it, then
+// the parameters of the link's template and of its owner's. Forwarded
+// parameters win over those of longURL, which win over the templates.
+// owner reports that the owner's template was applied.
+func (s *Shortener) withParams(link *URLMapping, longURL, variant string, visit Visit) (merged string, owner bool) {
+	passthrough := ""
+	if link.QueryPassthrough {
+		passthrough = visit.Query
+	}
+	vars := utm.Vars{ShortID: link.ShortID, Variant: variant, Country: visit.Country}
+	var defaults [][]utm.Param
+	if link.UTM != nil {
+		defaults = append(defaults, utm.Params(*link.UTM, vars))
+	}
+	if s.ownerUTM != nil {
+		if t, ok := s.ownerUTM.OwnerUTM(link.Owner); ok {
+			defaults = append(defaults, utm.Params(t, vars))
+			owner = true
+		}
+	}
+	if passthrough == "" && len(defaults) == 0 {
+		return longURL, false
+	}
+	merged = utm.Merge(longURL, passthrough, defaults...)
+	if merged != longURL {
+		metrics.DestinationParams.Inc()
+	}
+	return merged, owner
+}
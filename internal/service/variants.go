@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/metrics"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+)
+
+type Variant = repository.Variant
+
+// Bounds of the variants of a link.
+const (
+	MaxVariants      = 10
+	MaxVariantWeight = 1000
+	maxVariantID     = 32
+)
+
+var ErrInvalidVariants = errors.New("invalid variants")
+
+// checkVariants validates variants and the URL of each one. Variants without
+// an ID are named "a", "b", ... by position, and those without a weight get
+// a weight of 1.
+func (s *Shortener) checkVariants(ctx context.Context, variants []Variant) ([]Variant, error) {
+	switch {
+	case len(variants) == 0:
+		return nil, nil
+	case len(variants) == 1:
+		return nil, fmt.Errorf("%w: at least 2 variants are needed", ErrInvalidVariants)
+	case len(variants) > MaxVariants:
+		return nil, fmt.Errorf("%w: at most %d variants are allowed", ErrInvalidVariants, MaxVariants)
+	}
+	checked := make([]Variant, len(variants))
+	seen := make(map[string]bool, len(variants))
+	for i, v := range variants {
+		id := strings.ToLower(strings.TrimSpace(v.ID))
+		if id == "" {
+			id = string(rune('a' + i))
+		}
+		if !validVariantID(id) {
+			return nil, fmt.Errorf("%w: ID %q must be up to %d letters, digits, '-' or '_'", ErrInvalidVariants, id, maxVariantID)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("%w: ID %q is used twice", ErrInvalidVariants, id)
+		}
+		seen[id] = true
+
+		weight := v.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		if weight < 0 || weight > MaxVariantWeight {
+			return nil, fmt.Errorf("%w: weight of %q must be between 1 and %d", ErrInvalidVariants, id, MaxVariantWeight)
+		}
+		longURL, err := s.checkNestedDestination(ctx, fmt.Sprintf("variant %q", id), v.LongURL)
+		if err != nil {
+			return nil, err
+		}
+		checked[i] = Variant{ID: id, LongURL: longURL, Weight: weight}
+	}
+	return checked, nil
+}
+
+func validVariantID(id string) bool {
+	if len(id) > maxVariantID {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// pickVariant returns the variant named sticky when the link still has it,
+// so returning visitors keep theirs, and otherwise draws one by weight.
+func pickVariant(variants []Variant, sticky string) (Variant, bool) {
+	if len(variants) == 0 {
+		return Variant{}, false
+	}
+	total := 0
+	for _, v := range variants {
+		if v.ID == sticky {
+			metrics.VariantAssignments.WithLabelValues("sticky").Inc()
+			return v, true
+		}
+		total += v.Weight
+	}
+	metrics.VariantAssignments.WithLabelValues("new").Inc()
+	n := rand.IntN(total)
+	for _, v := range variants {
+		if n < v.Weight {
+			return v, true
+		}
+		n -= v.Weight
+	}
+	return variants[len(variants)-1], true
+}
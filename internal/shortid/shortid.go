@@ -0,0 +1,145 @@
+// Package shortid generates the IDs used in short URLs.
+package shortid
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"time"
+)
+
+const (
+	StrategyRandom  = "random"
+	StrategyCounter = "counter"
+	StrategyHash    = "hash"
+
+	DefaultLength = 8
+
+	// maxCounterLength keeps 62^length within a uint64.
+	maxCounterLength = 10
+)
+
+const alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Generator produces candidate short IDs. Uniqueness is enforced by the store,
+// so callers retry with a fresh candidate when an ID is already taken.
+type Generator interface {
+	Name() string
+	Generate(ctx context.Context, longURL string) (string, error)
+}
+
+// Sequence hands out monotonically increasing numbers for CounterGenerator.
+type Sequence interface {
+	NextSequence(ctx context.Context) (uint64, error)
+}
+
+// New builds the generator for the given strategy. seq is only required by
+// the counter strategy.
+func New(strategy string, length int, seq Sequence) (Generator, error) {
+	if length <= 0 {
+		length = DefaultLength
+	}
+	switch strategy {
+	case "", StrategyRandom:
+		return NewRandomGenerator(length), nil
+	case StrategyHash:
+		return NewHashGenerator(length), nil
+	case StrategyCounter:
+		if seq == nil {
+			return nil, fmt.Errorf("counter strategy requires a sequence")
+		}
+		if length > maxCounterLength {
+			return nil, fmt.Errorf("counter strategy supports at most %d characters", maxCounterLength)
+		}
+		return NewCounterGenerator(length, seq), nil
+	default:
+		return nil, fmt.Errorf("unknown short ID strategy %q", strategy)
+	}
+}
+
+// RandomGenerator draws every character uniformly from the base62 alphabet.
+type RandomGenerator struct {
+	length int
+}
+
+func NewRandomGenerator(length int) *RandomGenerator {
+	return &RandomGenerator{length: length}
+}
+
+func (g *RandomGenerator) Name() string { return StrategyRandom }
+
+func (g *RandomGenerator) Generate(ctx context.Context, longURL string) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+	id := make([]byte, g.length)
+	for i := range id {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		id[i] = alphabet[n.Int64()]
+	}
+	return string(id), nil
+}
+
+// HashGenerator derives the ID from sha256(url + timestamp), so retries for
+// the same URL still produce different candidates.
+type HashGenerator struct {
+	length int
+}
+
+func NewHashGenerator(length int) *HashGenerator {
+	return &HashGenerator{length: length}
+}
+
+func (g *HashGenerator) Name() string { return StrategyHash }
+
+func (g *HashGenerator) Generate(ctx context.Context, longURL string) (string, error) {
+	hash := sha256.Sum256([]byte(longURL + fmt.Sprint(time.Now().UnixNano())))
+	return encode(binary.BigEndian.Uint64(hash[:8]), g.length), nil
+}
+
+// CounterGenerator maps a sequence number to an ID through a bijection on
+// [0, 62^length), so IDs never repeat until the space is exhausted but
+// consecutive links do not get guessable consecutive IDs.
+type CounterGenerator struct {
+	length int
+	space  uint64
+	seq    Sequence
+}
+
+// obfuscationPrime is coprime with 62, which makes multiplication modulo 62^n
+// a permutation of the ID space.
+const obfuscationPrime = 25214903917
+
+func NewCounterGenerator(length int, seq Sequence) *CounterGenerator {
+	space := uint64(1)
+	for i := 0; i < length; i++ {
+		space *= uint64(len(alphabet))
+	}
+	return &CounterGenerator{length: length, space: space, seq: seq}
+}
+
+func (g *CounterGenerator) Name() string { return StrategyCounter }
+
+func (g *CounterGenerator) Generate(ctx context.Context, longURL string) (string, error) {
+	n, err := g.seq.NextSequence(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to read sequence: %w", err)
+	}
+	hi, lo := bits.Mul64(n%g.space, obfuscationPrime)
+	return encode(bits.Rem64(hi, lo, g.space), g.length), nil
+}
+
+// encode writes n in base62, left-padded to length characters.
+func encode(n uint64, length int) string {
+	id := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		id[i] = alphabet[n%uint64(len(alphabet))]
+		n /= uint64(len(alphabet))
+	}
+	return string(id)
+}
@@ -0,0 +1,58 @@
+package shortid
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type counter struct{ n atomic.Uint64 }
+
+func (c *counter) NextSequence(ctx context.Context) (uint64, error) {
+	return c.n.Add(1), nil
+}
+
+func TestGenerators_LengthAndAlphabet(t *testing.T) {
+	for _, strategy := range []string{StrategyRandom, StrategyHash, StrategyCounter} {
+		t.Run(strategy, func(t *testing.T) {
+			g, err := New(strategy, 8, &counter{})
+			require.NoError(t, err)
+			assert.Equal(t, strategy, g.Name())
+
+			id, err := g.Generate(context.Background(), "https://example.com")
+			require.NoError(t, err)
+			assert.Len(t, id, 8)
+			for _, r := range id {
+				assert.Contains(t, alphabet, string(r))
+			}
+		})
+	}
+}
+
+func TestCounterGenerator_IsUniqueAndNotSequential(t *testing.T) {
+	g := NewCounterGenerator(4, &counter{})
+	seen := make(map[string]bool)
+	var prev string
+	for i := 0; i < 10000; i++ {
+		id, err := g.Generate(context.Background(), "")
+		require.NoError(t, err)
+		require.False(t, seen[id], "duplicate id %s after %d ids", id, i)
+		seen[id] = true
+		if prev != "" {
+			assert.NotEqual(t, prev[:3], id[:3])
+		}
+		prev = id
+	}
+}
+
+func TestNew_RejectsInvalidConfiguration(t *testing.T) {
+	_, err := New("sequential", 8, nil)
+	assert.Error(t, err)
+	_, err = New(StrategyCounter, 8, nil)
+	assert.Error(t, err)
+	_, err = New(StrategyCounter, 11, &counter{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+// Package urlnorm reduces URLs to a canonical form so that equivalent
+// destinations can be recognised.
+package urlnorm
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+)
+
+var ErrNotAbsolute = errors.New("URL must be absolute")
+
+// trackingParams are query parameters that identify a campaign or a click
+// rather than the resource, matched case-insensitively. Every utm_* parameter
+// is stripped as well.
+var trackingParams = map[string]bool{
+	"fbclid":    true,
+	"gclid":     true,
+	"dclid":     true,
+	"gbraid":    true,
+	"wbraid":    true,
+	"msclkid":   true,
+	"yclid":     true,
+	"twclid":    true,
+	"ttclid":    true,
+	"igshid":    true,
+	"li_fat_id": true,
+	"mc_cid":    true,
+	"mc_eid":    true,
+	"_ga":       true,
+	"_gl":       true,
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Normalize lower-cases the scheme and host, drops the default port, an empty
+// path becomes "/", tracking parameters are removed and the remaining query
+// parameters are sorted by name. Paths and fragments are kept as they are,
+// since they are case-sensitive in general.
+func Normalize(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", ErrNotAbsolute
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	query := u.Query()
+	for name := range query {
+		lower := strings.ToLower(name)
+		if trackingParams[lower] || strings.HasPrefix(lower, "utm_") {
+			query.Del(name)
+		}
+	}
+	// Encode sorts by parameter name.
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
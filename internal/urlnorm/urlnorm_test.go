@@ -0,0 +1,30 @@
+package urlnorm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"HTTPS://Example.COM":                                   "https://example.com/",
+		"https://example.com:443/Path?b=2&a=1":                  "https://example.com/Path?a=1&b=2",
+		"http://example.com:80/":                                "http://example.com/",
+		"http://example.com:8080/":                              "http://example.com:8080/",
+		"https://example.com/p?utm_source=x&UTM_Medium=y&id=7":  "https://example.com/p?id=7",
+		"https://example.com/p?fbclid=abc&gclid=def":            "https://example.com/p",
+		"https://example.com./p?":                               "https://example.com/p",
+		"https://[2001:DB8::1]:443/p#Section":                   "https://[2001:db8::1]/p#Section",
+		"  https://shop.example.com/item?color=red&size=m#top ": "https://shop.example.com/item?color=red&size=m#top",
+	}
+	for in, want := range cases {
+		got, err := Normalize(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	_, err := Normalize("/relative/path")
+	assert.ErrorIs(t, err, ErrNotAbsolute)
+}
@@ -0,0 +1,75 @@
+package urlpolicy
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// confusableScripts are the scripts with letters that render like Latin ones.
+var confusableScripts = []*unicode.RangeTable{unicode.Cyrillic, unicode.Greek, unicode.Armenian}
+
+// latinLookalikes are the lower-case Cyrillic, Greek and Armenian letters that
+// are indistinguishable from a Latin letter in common fonts.
+var latinLookalikes = map[rune]bool{
+	'а': true, 'е': true, 'о': true, 'р': true, 'с': true, 'у': true, 'х': true,
+	'ѕ': true, 'і': true, 'ј': true, 'һ': true, 'ԁ': true, 'ԛ': true, 'ԝ': true,
+	'ӏ': true, 'ү': true,
+	'α': true, 'ο': true, 'ρ': true, 'υ': true, 'ν': true, 'ι': true, 'χ': true,
+	'օ': true, 'ս': true, 'ց': true, 'հ': true, 'ո': true,
+}
+
+// homograph returns the first punycode label of host that mixes Latin with a
+// confusable script, mixes two confusable scripts, or is written entirely
+// with Latin look-alikes.
+func homograph(host string) (string, bool) {
+	for _, label := range strings.Split(host, ".") {
+		if !strings.HasPrefix(label, "xn--") {
+			continue
+		}
+		decoded, err := idna.Punycode.ToUnicode(label)
+		if err != nil {
+			continue
+		}
+		if suspiciousLabel(decoded) {
+			return decoded, true
+		}
+	}
+	return "", false
+}
+
+func suspiciousLabel(label string) bool {
+	latin := false
+	scripts := make(map[*unicode.RangeTable]bool)
+	lookalikes := true
+	letters := 0
+	for _, r := range label {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.Is(unicode.Latin, r) {
+			latin = true
+			lookalikes = false
+			continue
+		}
+		confusable := false
+		for _, script := range confusableScripts {
+			if unicode.Is(script, r) {
+				scripts[script], confusable = true, true
+			}
+		}
+		if !confusable || !latinLookalikes[r] {
+			lookalikes = false
+		}
+	}
+	switch {
+	case len(scripts) > 1:
+		return true
+	case latin && len(scripts) == 1:
+		return true
+	default:
+		return letters > 0 && lookalikes
+	}
+}
@@ -0,0 +1,253 @@
+// Package urlpolicy decides which destination URLs may be shortened. It
+// guards against dangerous schemes, requests to internal hosts (SSRF),
+// redirect loops through the shortener itself and look-alike domains.
+package urlpolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var ErrRejected = errors.New("destination URL rejected by policy")
+
+// Violation codes reported in Error.
+const (
+	CodeInvalidURL    = "invalid_url"
+	CodeScheme        = "scheme_not_allowed"
+	CodeCredentials   = "credentials_not_allowed"
+	CodeInvalidHost   = "invalid_host"
+	CodePrivateHost   = "private_host"
+	CodeSelfReference = "self_reference"
+	CodeHomograph     = "homograph_domain"
+	// CodeBlockedDomain is reported by callers that check a domain list on
+	// top of the policy.
+	CodeBlockedDomain = "blocked_domain"
+)
+
+// Violation is one reason a URL was rejected.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error lists every violation of a rejected URL. It wraps ErrRejected.
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Message
+	}
+	return ErrRejected.Error() + ": " + strings.Join(msgs, "; ")
+}
+
+func (e *Error) Unwrap() error {
+	return ErrRejected
+}
+
+// Resolver looks up the addresses of a host name; *net.Resolver implements it.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Policy is the set of rules a destination URL must satisfy.
+type Policy struct {
+	// Schemes are the allowed URL schemes, lower-case.
+	Schemes []string
+	// AllowPrivate permits loopback, private, link-local and other
+	// non-public hosts.
+	AllowPrivate bool
+	// AllowHomographs permits internationalized labels that mix scripts or
+	// only use characters that look like Latin letters.
+	AllowHomographs bool
+	// SelfHosts are the hosts serving short links; destinations on them
+	// would redirect back into the shortener.
+	SelfHosts []string
+	// Resolver, when set, makes host names that resolve to a non-public
+	// address count as private hosts too.
+	Resolver Resolver
+}
+
+// Default allows public http and https URLs only.
+func Default() *Policy {
+	return &Policy{Schemes: []string{"http", "https"}}
+}
+
+// WithSelfHost returns a copy of p that also treats host as its own.
+func (p *Policy) WithSelfHost(host string) *Policy {
+	cp := *p
+	cp.SelfHosts = append(append([]string(nil), p.SelfHosts...), host)
+	return &cp
+}
+
+// Check validates raw and returns it with its host converted to the ASCII
+// (punycode) form, or an *Error listing every violation.
+func (p *Policy) Check(ctx context.Context, raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() {
+		return "", Reject(CodeInvalidURL, "URL must be absolute")
+	}
+	if !p.schemeAllowed(u.Scheme) {
+		return "", Reject(CodeScheme, fmt.Sprintf("scheme %q is not allowed, use one of %s", u.Scheme, strings.Join(p.Schemes, ", ")))
+	}
+	if u.Host == "" {
+		return "", Reject(CodeInvalidHost, "URL has no host")
+	}
+
+	var violations []Violation
+	add := func(code, msg string) {
+		violations = append(violations, Violation{Code: code, Message: msg})
+	}
+
+	if u.User != nil {
+		add(CodeCredentials, "URL must not contain credentials")
+	}
+
+	host, err := asciiHost(u.Hostname())
+	if err != nil {
+		add(CodeInvalidHost, fmt.Sprintf("host %q is not a valid domain name", u.Hostname()))
+		return "", &Error{Violations: violations}
+	}
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+
+	if !p.AllowHomographs {
+		if label, ok := homograph(host); ok {
+			add(CodeHomograph, fmt.Sprintf("label %q looks like a Latin domain name", label))
+		}
+	}
+	if p.isSelfHost(host) {
+		add(CodeSelfReference, "URL points back to this shortener")
+	}
+	if !p.AllowPrivate {
+		if msg := p.privateHost(ctx, host); msg != "" {
+			add(CodePrivateHost, msg)
+		}
+	}
+
+	if len(violations) > 0 {
+		return "", &Error{Violations: violations}
+	}
+	return u.String(), nil
+}
+
+// Reject returns an Error with a single violation.
+func Reject(code, msg string) *Error {
+	return &Error{Violations: []Violation{{Code: code, Message: msg}}}
+}
+
+func (p *Policy) schemeAllowed(scheme string) bool {
+	for _, s := range p.Schemes {
+		if strings.EqualFold(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) isSelfHost(host string) bool {
+	for _, h := range p.SelfHosts {
+		if strings.EqualFold(strings.TrimSuffix(h, "."), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// asciiHost lower-cases host, drops a trailing dot and converts
+// internationalized domain names to punycode. IP literals are returned as is.
+func asciiHost(host string) (string, error) {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return "", errors.New("empty host")
+	}
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+	return idna.Lookup.ToASCII(host)
+}
+
+// privateHost describes why host is not a public destination, or returns "".
+func (p *Policy) privateHost(ctx context.Context, host string) string {
+	if ip := parseIP(host); ip != nil {
+		if !publicIP(ip) {
+			return fmt.Sprintf("address %s is not public", ip)
+		}
+		return ""
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") ||
+		strings.HasSuffix(host, ".local") || strings.HasSuffix(host, ".internal") {
+		return fmt.Sprintf("host %q is internal", host)
+	}
+	if p.Resolver == nil {
+		return ""
+	}
+	addrs, err := p.Resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return ""
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return fmt.Sprintf("host %q resolves to non-public address %s", host, addr.IP)
+		}
+	}
+	return ""
+}
+
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		ip.Equal(net.IPv4bcast) || sharedAddressSpace.Contains(ip))
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// parseIP parses host as an IP address, including the shorthand IPv4 forms
+// browsers accept, such as "127.1", "2130706433" and "0x7f.0.0.1".
+func parseIP(host string) net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+	nums := make([]uint64, len(parts))
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 0, 32)
+		if err != nil {
+			return nil
+		}
+		nums[i] = n
+	}
+	// Every part but the last is one byte; the last fills the remaining bytes.
+	var addr uint64
+	for i, n := range nums[:len(nums)-1] {
+		if n > 0xff {
+			return nil
+		}
+		addr |= n << (8 * (3 - i))
+	}
+	last := nums[len(nums)-1]
+	if last >= 1<<(8*(5-len(nums))) {
+		return nil
+	}
+	addr |= last
+	return net.IPv4(byte(addr>>24), byte(addr>>16), byte(addr>>8), byte(addr))
+}
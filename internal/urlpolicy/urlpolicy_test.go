@@ -0,0 +1,91 @@
+package urlpolicy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeResolver map[string][]net.IPAddr
+
+func (r fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	return r[host], nil
+}
+
+func codes(t *testing.T, err error) []string {
+	t.Helper()
+	var perr *Error
+	require.True(t, errors.As(err, &perr), "expected a policy error, got %v", err)
+	assert.ErrorIs(t, err, ErrRejected)
+	out := make([]string, len(perr.Violations))
+	for i, v := range perr.Violations {
+		out[i] = v.Code
+	}
+	return out
+}
+
+func TestPolicy_Check(t *testing.T) {
+	ctx := context.Background()
+	p := Default().WithSelfHost("sho.rt")
+
+	got, err := p.Check(ctx, "https://Bücher.Example/p?q=1")
+	require.NoError(t, err)
+	assert.Equal(t, "https://xn--bcher-kva.example/p?q=1", got)
+
+	got, err = p.Check(ctx, "https://example.com:8443/")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com:8443/", got)
+
+	rejected := map[string][]string{
+		"javascript:alert(1)":            {CodeScheme},
+		"data:text/html,hi":              {CodeScheme},
+		"file:///etc/passwd":             {CodeScheme},
+		"/relative":                      {CodeInvalidURL},
+		"http://127.0.0.1/admin":         {CodePrivateHost},
+		"http://10.1.2.3":                {CodePrivateHost},
+		"http://169.254.169.254/latest/": {CodePrivateHost},
+		"http://[::1]:8080/":             {CodePrivateHost},
+		"http://2130706433/":             {CodePrivateHost},
+		"http://0x7f.1/":                 {CodePrivateHost},
+		"http://localhost:8080/x":        {CodePrivateHost},
+		"http://db.internal/":            {CodePrivateHost},
+		"https://SHO.RT./abc123":         {CodeSelfReference},
+		"https://user:pw@example.com/":   {CodeCredentials},
+		"https://аррӏе.com/":             {CodeHomograph},
+		"https://pаypal.com/":            {CodeHomograph},
+		"https://xn--80ak6aa92e.com/":    {CodeHomograph},
+		"https://admin@sho.rt/":          {CodeCredentials, CodeSelfReference},
+	}
+	for raw, want := range rejected {
+		_, err := p.Check(ctx, raw)
+		assert.Equal(t, want, codes(t, err), raw)
+	}
+
+	for _, ok := range []string{"https://москва.рф/", "https://例え.jp/", "https://8.8.8.8/"} {
+		_, err := p.Check(ctx, ok)
+		assert.NoError(t, err, ok)
+	}
+}
+
+func TestPolicy_Configurable(t *testing.T) {
+	ctx := context.Background()
+	p := &Policy{Schemes: []string{"https", "ftp"}, AllowPrivate: true, AllowHomographs: true}
+
+	_, err := p.Check(ctx, "ftp://10.0.0.1/file")
+	assert.NoError(t, err)
+	_, err = p.Check(ctx, "https://аррӏе.com/")
+	assert.NoError(t, err)
+	_, err = p.Check(ctx, "http://example.com/")
+	assert.Equal(t, []string{CodeScheme}, codes(t, err))
+
+	p = Default()
+	p.Resolver = fakeResolver{"rebind.example": {{IP: net.ParseIP("192.168.0.10")}}}
+	_, err = p.Check(ctx, "https://rebind.example/")
+	assert.Equal(t, []string{CodePrivateHost}, codes(t, err))
+	_, err = p.Check(ctx, "https://example.com/")
+	assert.NoError(t, err)
+}
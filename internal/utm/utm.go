@@ -0,0 +1,194 @@
+// Package utm adds UTM parameters and forwarded query strings to destination
+// URLs at redirect time, and keeps the owner templates loaded in memory.
+package utm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/logger"
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+)
+
+type UTM = repository.UTM
+
+// maxValueLength caps each value of a template.
+const maxValueLength = 200
+
+var ErrInvalidTemplate = errors.New("invalid UTM template")
+
+// Param is a query parameter, unescaped.
+type Param struct {
+	Key, Value string
+}
+
+// Vars are the values of the placeholders of a template.
+type Vars struct {
+	ShortID string
+	Variant string
+	Country string
+}
+
+// Check trims the values of t and validates their length.
+func Check(t UTM) (UTM, error) {
+	fields := []*string{&t.Source, &t.Medium, &t.Campaign, &t.Term, &t.Content}
+	for _, f := range fields {
+		*f = strings.TrimSpace(*f)
+		if len(*f) > maxValueLength {
+			return UTM{}, fmt.Errorf("%w: values must be at most %d bytes", ErrInvalidTemplate, maxValueLength)
+		}
+	}
+	return t, nil
+}
+
+// Params expands the placeholders of t with vars and returns its non-empty
+// parameters.
+func Params(t UTM, vars Vars) []Param {
+	r := strings.NewReplacer("{short_id}", vars.ShortID, "{variant}", vars.Variant, "{country}", vars.Country)
+	var params []Param
+	for _, p := range []Param{
+		{"utm_source", t.Source},
+		{"utm_medium", t.Medium},
+		{"utm_campaign", t.Campaign},
+		{"utm_term", t.Term},
+		{"utm_content", t.Content},
+	} {
+		if p.Value = r.Replace(p.Value); p.Value != "" {
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
+// pair is a raw "key=value" query component with its unescaped key.
+type pair struct {
+	key, raw string
+}
+
+func splitQuery(query string) []pair {
+	var pairs []pair
+	for _, raw := range strings.Split(query, "&") {
+		if raw == "" {
+			continue
+		}
+		k, _, _ := strings.Cut(raw, "=")
+		key, err := url.QueryUnescape(k)
+		if err != nil || key == "" {
+			continue
+		}
+		pairs = append(pairs, pair{key, raw})
+	}
+	return pairs
+}
+
+// Merge adds parameters to the query of rawURL. Every parameter of the raw
+// query passthrough replaces those of rawURL with the same key; defaults,
+// from highest to lowest precedence, only fill in keys still missing.
+// Existing components are kept exactly as written, so nothing gets escaped
+// twice, and the fragment stays at the end.
+func Merge(rawURL, passthrough string, defaults ...[]Param) string {
+	if passthrough == "" && len(defaults) == 0 {
+		return rawURL
+	}
+	base, fragment, hasFragment := strings.Cut(rawURL, "#")
+	base, query, _ := strings.Cut(base, "?")
+
+	forwarded := splitQuery(passthrough)
+	replaced := make(map[string]bool, len(forwarded))
+	for _, p := range forwarded {
+		replaced[p.key] = true
+	}
+	seen := make(map[string]bool)
+	var parts []string
+	for _, p := range splitQuery(query) {
+		if !replaced[p.key] {
+			parts = append(parts, p.raw)
+			seen[p.key] = true
+		}
+	}
+	for _, p := range forwarded {
+		parts = append(parts, p.raw)
+		seen[p.key] = true
+	}
+	for _, params := range defaults {
+		for _, p := range params {
+			if !seen[p.Key] {
+				parts = append(parts, url.QueryEscape(p.Key)+"="+url.QueryEscape(p.Value))
+				seen[p.Key] = true
+			}
+		}
+	}
+
+	out := base
+	if len(parts) > 0 {
+		out += "?" + strings.Join(parts, "&")
+	}
+	if hasFragment {
+		out += "#" + fragment
+	}
+	return out
+}
+
+// Templates holds the owner templates of a UTMStore. Lookups read an
+// immutable snapshot, replaced as a whole by Reload.
+type Templates struct {
+	store     repository.UTMStore
+	templates atomic.Pointer[map[string]UTM]
+	mu        sync.Mutex // serializes Reload
+}
+
+// NewTemplates returns an empty set; call Reload to load the store.
+func NewTemplates(store repository.UTMStore) *Templates {
+	t := &Templates{store: store}
+	t.templates.Store(&map[string]UTM{})
+	return t
+}
+
+// Reload loads every template and swaps them in. On error the current
+// templates are kept.
+func (t *Templates) Reload(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	loaded, err := t.store.ListOwnerUTM(ctx)
+	if err != nil {
+		return err
+	}
+	templates := make(map[string]UTM, len(loaded))
+	for _, o := range loaded {
+		templates[o.Owner] = o.UTM
+	}
+	t.templates.Store(&templates)
+	return nil
+}
+
+// Run reloads the templates every interval until ctx is done.
+func (t *Templates) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.Reload(ctx); err != nil {
+				logger.Log.Warnf("UTM template reload error: %v", err)
+			}
+		}
+	}
+}
+
+// OwnerUTM returns the template of owner.
+func (t *Templates) OwnerUTM(owner string) (UTM, bool) {
+	if owner == "" {
+		return UTM{}, false
+	}
+	u, ok := (*t.templates.Load())[owner]
+	return u, ok
+}
@@ -0,0 +1,66 @@
+package utm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/joaopaulo-bertoncini/url-shortener/internal/repository"
+)
+
+func TestMerge_Precedence(t *testing.T) {
+	link := Params(UTM{Source: "newsletter", Campaign: "spring sale"}, Vars{})
+	owner := Params(UTM{Source: "acme", Medium: "email", Content: "{short_id}-{variant}"}, Vars{ShortID: "abc123", Variant: "b"})
+
+	got := Merge("https://example.com/p?utm_campaign=launch&q=a%20b%2Bc#top", "utm_source=partner&ref=x%26y", link, owner)
+	assert.Equal(t, "https://example.com/p?utm_campaign=launch&q=a%20b%2Bc&utm_source=partner&ref=x%26y&utm_medium=email&utm_content=abc123-b#top", got)
+
+	// A forwarded key replaces every value of the destination.
+	got = Merge("https://example.com/?tag=a&tag=b&keep=1", "tag=c", nil)
+	assert.Equal(t, "https://example.com/?keep=1&tag=c", got)
+}
+
+func TestMerge_NoDoubleEscaping(t *testing.T) {
+	params := Params(UTM{Campaign: "100% off & more"}, Vars{})
+	got := Merge("https://example.com/search?q=caf%C3%A9+cr%C3%A8me", "", params)
+	assert.Equal(t, "https://example.com/search?q=caf%C3%A9+cr%C3%A8me&utm_campaign=100%25+off+%26+more", got)
+
+	// Merging into a merged URL adds nothing and escapes nothing again.
+	assert.Equal(t, got, Merge(got, "", params))
+
+	assert.Equal(t, "https://example.com/", Merge("https://example.com/", "", nil))
+	assert.Equal(t, "https://example.com/?", Merge("https://example.com/?", ""))
+}
+
+func TestParams_SkipsEmptyValues(t *testing.T) {
+	params := Params(UTM{Source: "site", Content: "{variant}"}, Vars{})
+	assert.Equal(t, []Param{{"utm_source", "site"}}, params)
+}
+
+func TestCheck(t *testing.T) {
+	got, err := Check(UTM{Source: "  site  "})
+	require.NoError(t, err)
+	assert.Equal(t, UTM{Source: "site"}, got)
+
+	_, err = Check(UTM{Campaign: strings.Repeat("x", maxValueLength+1)})
+	assert.ErrorIs(t, err, ErrInvalidTemplate)
+}
+
+func TestTemplates_Reload(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryUTMStore()
+	templates := NewTemplates(store)
+	require.NoError(t, store.PutOwnerUTM(ctx, &repository.OwnerUTM{Owner: "team", UTM: UTM{Source: "blog"}}))
+
+	_, ok := templates.OwnerUTM("team")
+	assert.False(t, ok)
+	require.NoError(t, templates.Reload(ctx))
+	got, ok := templates.OwnerUTM("team")
+	require.True(t, ok)
+	assert.Equal(t, "blog", got.Source)
+	_, ok = templates.OwnerUTM("")
+	assert.False(t, ok)
+}